@@ -2,13 +2,16 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
 	"errors"
 	"github.com/caarlos0/env/v11"
 	"github.com/ownerofglory/webrtc-sfu-demo/config"
 	"github.com/ownerofglory/webrtc-sfu-demo/internal/cloudflare"
+	"github.com/ownerofglory/webrtc-sfu-demo/internal/core/ports"
 	"github.com/ownerofglory/webrtc-sfu-demo/internal/core/services"
 	"github.com/ownerofglory/webrtc-sfu-demo/internal/handler"
 	"github.com/ownerofglory/webrtc-sfu-demo/internal/middleware"
+	"github.com/pion/ion-sfu/pkg/buffer"
 	"github.com/pion/ion-sfu/pkg/sfu"
 	"log/slog"
 	"net/http"
@@ -26,6 +29,10 @@ func main() {
 	if err != nil {
 		slog.Error("Failed to parse config", "error", err)
 	}
+	if err := cfg.Validate(); err != nil {
+		slog.Error("Invalid config", "error", err)
+		os.Exit(1)
+	}
 
 	logLevel := slog.LevelInfo
 	if err := logLevel.UnmarshalText([]byte(cfg.LogLevel)); err != nil {
@@ -41,10 +48,54 @@ func main() {
 
 	nicknameGenerator := services.NewNicknameGenerator()
 	roomNameGenerator := services.NewRoomGenerator()
-	sfuHandler := sfu.NewSFU(sfu.Config{})
-	cloudFlareRTCClient := cloudflare.NewClient(cfg.TURNKey, cfg.TURNAPIToken, &http.Client{})
+	roomRegistry := services.NewRoomRegistry(cfg.RoomMaxParticipants, cfg.RoomMaxPublishers, cfg.MaxPeers)
+
+	resumeSecret := []byte(cfg.ResumeSecret)
+	if len(resumeSecret) == 0 {
+		resumeSecret = make([]byte, 32)
+		if _, err := rand.Read(resumeSecret); err != nil {
+			slog.Error("Failed to generate resume secret", "error", err)
+			os.Exit(1)
+		}
+	}
+	resumeTokens := services.NewResumeTokenService(resumeSecret)
+	chatHistory := services.NewChatHistory(cfg.ChatHistorySize)
+
+	var tokenVerifier ports.TokenVerifier
+	if cfg.AuthSecret != "" {
+		accessTokens := services.NewAccessTokenService([]byte(cfg.AuthSecret))
+		tokenVerifier = accessTokens
+
+		if cfg.AuthAPIKey != "" {
+			accessTokenHandler := handler.NewAccessTokenHandler(&cfg, accessTokens)
+			h.Handle(http.MethodPost+" "+handler.PostAccessTokenPath,
+				middleware.APIKey(cfg.AuthAPIKey)(http.HandlerFunc(accessTokenHandler.HandlePostAccessToken)))
+		} else {
+			slog.Warn("AUTH_API_KEY not set, access token endpoint disabled")
+		}
+	} else {
+		slog.Warn("AUTH_SECRET not set, room joins are not authenticated")
+	}
+
+	sfuConfig, err := cfg.SFUConfig()
+	if err != nil {
+		slog.Error("Invalid SFU config", "error", err)
+		os.Exit(1)
+	}
+	sfuConfig.BufferFactory = buffer.NewBufferFactory(sfuConfig.Router.MaxPacketTrack, sfu.Logger)
+	sfuHandler := sfu.NewSFU(sfuConfig)
+	cloudFlareRTCClient := cloudflare.NewClient(cfg.TURNKey, cfg.TURNAPIToken, &http.Client{Timeout: cfg.TURNRequestTimeout})
 	rtcConfigFetcher := services.NewRTCConfigFetcher(cloudFlareRTCClient)
-	wsHandler := handler.NewWSHandler(&cfg, sfuHandler, rtcConfigFetcher, nicknameGenerator, roomNameGenerator)
+	wsHandler := handler.NewWSHandler(&cfg,
+		sfuConfig,
+		sfuHandler,
+		rtcConfigFetcher,
+		nicknameGenerator,
+		roomNameGenerator,
+		roomRegistry,
+		resumeTokens,
+		chatHistory,
+		tokenVerifier)
 	h.HandleFunc(handler.WSPath, wsHandler.HandleWS)
 
 	fs := http.FileServer(http.Dir("web"))
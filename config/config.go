@@ -1,9 +1,58 @@
 package config
 
+import "time"
+
+const (
+	SlowClientPolicyDisconnect = "disconnect"
+	SlowClientPolicyDrop       = "drop"
+)
+
 type WebRTCSFUAppConfig struct {
-	ServerAddr     string   `env:"SERVER_ADDR" envDefault:":8080"`
-	AllowedOrigins []string `env:"ALLOWED_ORIGINS" envDefault:"*"`
-	LogLevel       string   `env:"LOG_LEVEL" envDefault:"info"`
-	TURNKey        string   `env:"TURN_KEY" envDefault:""`
-	TURNAPIToken   string   `env:"TURN_API_TOKEN" envDefault:""`
+	ServerAddr         string        `env:"SERVER_ADDR" envDefault:":8080"`
+	AllowedOrigins     []string      `env:"ALLOWED_ORIGINS" envDefault:"*"`
+	LogLevel           string        `env:"LOG_LEVEL" envDefault:"info"`
+	TURNKey            string        `env:"TURN_KEY" envDefault:""`
+	TURNAPIToken       string        `env:"TURN_API_TOKEN" envDefault:""`
+	TURNRequestTimeout time.Duration `env:"TURN_REQUEST_TIMEOUT" envDefault:"5s"`
+	WSPingInterval     time.Duration `env:"WS_PING_INTERVAL" envDefault:"20s"`
+	WSPongTimeout      time.Duration `env:"WS_PONG_TIMEOUT" envDefault:"45s"`
+	WSWriteTimeout     time.Duration `env:"WS_WRITE_TIMEOUT" envDefault:"10s"`
+	WSHelloTimeout     time.Duration `env:"WS_HELLO_TIMEOUT" envDefault:"5s"`
+	WSWriteQueueSize   int           `env:"WS_WRITE_QUEUE_SIZE" envDefault:"256"`
+	WSSlowClientPolicy string        `env:"WS_SLOW_CLIENT_POLICY" envDefault:"disconnect"`
+	ResumeSecret       string        `env:"RESUME_SECRET" envDefault:""`
+	ResumeGracePeriod  time.Duration `env:"RESUME_GRACE_PERIOD" envDefault:"30s"`
+	AuthSecret         string        `env:"AUTH_SECRET" envDefault:""`
+	AuthAPIKey         string        `env:"AUTH_API_KEY" envDefault:""`
+	AuthTokenTTL       time.Duration `env:"AUTH_TOKEN_TTL" envDefault:"5m"`
+	AuthTokenMaxTTL    time.Duration `env:"AUTH_TOKEN_MAX_TTL" envDefault:"1h"`
+	ActiveSpeakerCount int           `env:"ACTIVE_SPEAKER_COUNT" envDefault:"1"`
+
+	DataChannelLabel          string `env:"DATA_CHANNEL_LABEL" envDefault:"room"`
+	DataChannelMaxMessageSize int    `env:"DATA_CHANNEL_MAX_MESSAGE_SIZE" envDefault:"16384"`
+
+	RoomMaxParticipants int `env:"ROOM_MAX_PARTICIPANTS" envDefault:"0"`
+	RoomMaxPublishers   int `env:"ROOM_MAX_PUBLISHERS" envDefault:"0"`
+	MaxPeers            int `env:"MAX_PEERS" envDefault:"0"`
+
+	ChatHistorySize int `env:"CHAT_HISTORY_SIZE" envDefault:"100"`
+	ChatMaxLength   int `env:"CHAT_MAX_LENGTH" envDefault:"2000"`
+
+	SFUICEPortMin             uint16        `env:"SFU_ICE_PORT_MIN" envDefault:"0"`
+	SFUICEPortMax             uint16        `env:"SFU_ICE_PORT_MAX" envDefault:"0"`
+	SFUNAT1To1IPs             []string      `env:"SFU_NAT1TO1_IPS" envDefault:""`
+	SFUICELite                bool          `env:"SFU_ICE_LITE" envDefault:"false"`
+	SFUSDPSemantics           string        `env:"SFU_SDP_SEMANTICS" envDefault:"unified-plan"`
+	SFUMDNS                   bool          `env:"SFU_MDNS" envDefault:"false"`
+	SFUICEDisconnectedTimeout time.Duration `env:"SFU_ICE_DISCONNECTED_TIMEOUT" envDefault:"0s"`
+	SFUICEFailedTimeout       time.Duration `env:"SFU_ICE_FAILED_TIMEOUT" envDefault:"0s"`
+	SFUICEKeepaliveInterval   time.Duration `env:"SFU_ICE_KEEPALIVE_INTERVAL" envDefault:"0s"`
+
+	SFUMaxBandwidth              uint64 `env:"SFU_MAX_BANDWIDTH" envDefault:"1500"`
+	SFUMaxPacketTrack            int    `env:"SFU_MAX_PACKET_TRACK" envDefault:"500"`
+	SFUAudioLevelInterval        int    `env:"SFU_AUDIO_LEVEL_INTERVAL" envDefault:"1000"`
+	SFUAudioLevelThreshold       uint8  `env:"SFU_AUDIO_LEVEL_THRESHOLD" envDefault:"40"`
+	SFUAudioLevelFilter          int    `env:"SFU_AUDIO_LEVEL_FILTER" envDefault:"20"`
+	SFUSimulcastBestQualityFirst bool   `env:"SFU_SIMULCAST_BEST_QUALITY_FIRST" envDefault:"true"`
+	SFUSimulcastTemporalLayer    bool   `env:"SFU_SIMULCAST_TEMPORAL_LAYER" envDefault:"false"`
 }
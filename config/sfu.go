@@ -0,0 +1,99 @@
+package config
+
+import (
+	"fmt"
+	"github.com/pion/ion-sfu/pkg/sfu"
+	"net"
+	"strings"
+	"time"
+)
+
+// Default ICE timeouts of pion, used for timeouts that are not configured.
+// ion-sfu only applies its timeouts all at once.
+const (
+	defaultICEDisconnectedTimeout = 5 * time.Second
+	defaultICEFailedTimeout       = 25 * time.Second
+	defaultICEKeepaliveInterval   = 2 * time.Second
+)
+
+// SFUConfig builds the ion-sfu configuration shared by the global SFU and
+// every room. ICE servers are added per room, and the buffer factory has to
+// be set by the caller so that all transports share a single one.
+func (c *WebRTCSFUAppConfig) SFUConfig() (sfu.Config, error) {
+	var conf sfu.Config
+
+	if c.SFUICEPortMin != 0 || c.SFUICEPortMax != 0 {
+		if c.SFUICEPortMin == 0 || c.SFUICEPortMax == 0 {
+			return conf, fmt.Errorf("SFU_ICE_PORT_MIN and SFU_ICE_PORT_MAX must be set together")
+		}
+		if c.SFUICEPortMin > c.SFUICEPortMax {
+			return conf, fmt.Errorf("SFU_ICE_PORT_MIN (%d) must not be greater than SFU_ICE_PORT_MAX (%d)",
+				c.SFUICEPortMin, c.SFUICEPortMax)
+		}
+		conf.WebRTC.ICEPortRange = []uint16{c.SFUICEPortMin, c.SFUICEPortMax}
+	}
+	for _, mapping := range c.SFUNAT1To1IPs {
+		// pion accepts an external IP or an external/local IP pair.
+		external, local, paired := strings.Cut(mapping, "/")
+		if net.ParseIP(external) == nil || paired && net.ParseIP(local) == nil {
+			return conf, fmt.Errorf("SFU_NAT1TO1_IPS contains invalid IP mapping %q", mapping)
+		}
+	}
+	switch c.SFUSDPSemantics {
+	case "unified-plan", "unified-plan-with-fallback", "plan-b":
+	default:
+		return conf, fmt.Errorf("SFU_SDP_SEMANTICS must be unified-plan, unified-plan-with-fallback or plan-b, got %q",
+			c.SFUSDPSemantics)
+	}
+	conf.WebRTC.Candidates = sfu.Candidates{
+		IceLite:    c.SFUICELite,
+		NAT1To1IPs: c.SFUNAT1To1IPs,
+	}
+	conf.WebRTC.SDPSemantics = c.SFUSDPSemantics
+	conf.WebRTC.MDNS = c.SFUMDNS
+
+	disconnected, err := iceTimeoutSeconds("SFU_ICE_DISCONNECTED_TIMEOUT", c.SFUICEDisconnectedTimeout, defaultICEDisconnectedTimeout)
+	if err != nil {
+		return conf, err
+	}
+	failed, err := iceTimeoutSeconds("SFU_ICE_FAILED_TIMEOUT", c.SFUICEFailedTimeout, defaultICEFailedTimeout)
+	if err != nil {
+		return conf, err
+	}
+	keepalive, err := iceTimeoutSeconds("SFU_ICE_KEEPALIVE_INTERVAL", c.SFUICEKeepaliveInterval, defaultICEKeepaliveInterval)
+	if err != nil {
+		return conf, err
+	}
+	conf.WebRTC.Timeouts = sfu.WebRTCTimeoutsConfig{
+		ICEDisconnectedTimeout: disconnected,
+		ICEFailedTimeout:       failed,
+		ICEKeepaliveInterval:   keepalive,
+	}
+
+	conf.Router = sfu.RouterConfig{
+		MaxBandwidth:        c.SFUMaxBandwidth,
+		MaxPacketTrack:      c.SFUMaxPacketTrack,
+		AudioLevelInterval:  c.SFUAudioLevelInterval,
+		AudioLevelThreshold: c.SFUAudioLevelThreshold,
+		AudioLevelFilter:    c.SFUAudioLevelFilter,
+		Simulcast: sfu.SimulcastConfig{
+			BestQualityFirst:    c.SFUSimulcastBestQualityFirst,
+			EnableTemporalLayer: c.SFUSimulcastTemporalLayer,
+		},
+	}
+
+	return conf, nil
+}
+
+// iceTimeoutSeconds converts an ICE timeout to the whole seconds ion-sfu
+// expects, falling back to def if it is not set.
+func iceTimeoutSeconds(name string, d, def time.Duration) (int, error) {
+	if d == 0 {
+		d = def
+	}
+	if d < 0 || d%time.Second != 0 {
+		return 0, fmt.Errorf("%s must be a positive whole number of seconds, got %s", name, d)
+	}
+
+	return int(d / time.Second), nil
+}
@@ -0,0 +1,42 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Validate rejects settings that would otherwise fail or misbehave only once
+// clients start connecting.
+func (c *WebRTCSFUAppConfig) Validate() error {
+	var errs []error
+
+	if c.WSPingInterval <= 0 {
+		errs = append(errs, fmt.Errorf("WS_PING_INTERVAL must be positive, got %s", c.WSPingInterval))
+	}
+	if c.WSPongTimeout <= c.WSPingInterval {
+		errs = append(errs, fmt.Errorf("WS_PONG_TIMEOUT (%s) must be greater than WS_PING_INTERVAL (%s)",
+			c.WSPongTimeout, c.WSPingInterval))
+	}
+	if c.WSWriteTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("WS_WRITE_TIMEOUT must be positive, got %s", c.WSWriteTimeout))
+	}
+	if c.WSHelloTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("WS_HELLO_TIMEOUT must be positive, got %s", c.WSHelloTimeout))
+	}
+
+	if c.WSWriteQueueSize < 1 {
+		errs = append(errs, fmt.Errorf("WS_WRITE_QUEUE_SIZE must be at least 1, got %d", c.WSWriteQueueSize))
+	}
+	switch c.WSSlowClientPolicy {
+	case SlowClientPolicyDisconnect, SlowClientPolicyDrop:
+	default:
+		errs = append(errs, fmt.Errorf("WS_SLOW_CLIENT_POLICY must be %q or %q, got %q",
+			SlowClientPolicyDisconnect, SlowClientPolicyDrop, c.WSSlowClientPolicy))
+	}
+
+	if c.ActiveSpeakerCount < 1 {
+		errs = append(errs, fmt.Errorf("ACTIVE_SPEAKER_COUNT must be at least 1, got %d", c.ActiveSpeakerCount))
+	}
+
+	return errors.Join(errs...)
+}
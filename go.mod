@@ -43,7 +43,7 @@ require (
 	github.com/pion/turn/v2 v2.0.5 // indirect
 	github.com/pion/turn/v4 v4.1.1 // indirect
 	github.com/pion/udp v0.1.1 // indirect
-	github.com/pion/webrtc/v3 v3.1.7 // indirect
+	github.com/pion/webrtc/v3 v3.1.7
 	github.com/prometheus/client_golang v1.11.0 // indirect
 	github.com/prometheus/client_model v0.2.0 // indirect
 	github.com/prometheus/common v0.26.0 // indirect
@@ -0,0 +1,46 @@
+package domain
+
+import "errors"
+
+var ErrTokenExpired = errors.New("token expired")
+
+// Role defines what a client is allowed to do in a room.
+type Role string
+
+const (
+	RolePublisher  Role = "publisher"
+	RoleSubscriber Role = "subscriber"
+	RoleModerator  Role = "moderator"
+)
+
+// Valid reports whether r is a known role.
+func (r Role) Valid() bool {
+	switch r {
+	case RolePublisher, RoleSubscriber, RoleModerator:
+		return true
+	default:
+		return false
+	}
+}
+
+// CanPublish reports whether the role may publish media.
+func (r Role) CanPublish() bool {
+	return r == RolePublisher || r == RoleModerator
+}
+
+// CanModerate reports whether the role may send control messages.
+func (r Role) CanModerate() bool {
+	return r == RoleModerator
+}
+
+// AccessClaims grant access to a single room. They are carried as the
+// payload of an HS256 signed JWT. Subject is the identity assigned by the
+// token issuer, Name the display name used in the room.
+type AccessClaims struct {
+	Subject   string `json:"sub,omitempty"`
+	Room      string `json:"room"`
+	Name      string `json:"name,omitempty"`
+	Role      Role   `json:"role"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+	ExpiresAt int64  `json:"exp"`
+}
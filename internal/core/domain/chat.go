@@ -0,0 +1,9 @@
+package domain
+
+import "time"
+
+type ChatMessage struct {
+	From   string
+	Text   string
+	SentAt time.Time
+}
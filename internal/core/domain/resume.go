@@ -0,0 +1,12 @@
+package domain
+
+import "errors"
+
+var ErrInvalidToken = errors.New("invalid token")
+
+// ResumeClaims identify a client slot that can be reclaimed after a reconnect.
+type ResumeClaims struct {
+	ClientID string `json:"id"`
+	RoomID   string `json:"room"`
+	Nonce    string `json:"nonce"`
+}
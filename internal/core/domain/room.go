@@ -0,0 +1,24 @@
+package domain
+
+import (
+	"errors"
+	"github.com/pion/ion-sfu/pkg/sfu"
+)
+
+var (
+	ErrRoomNotFound   = errors.New("room not found")
+	ErrMemberExists   = errors.New("member already in room")
+	ErrRoomFull       = errors.New("room is full")
+	ErrServerFull     = errors.New("server is full")
+	ErrNameTaken      = errors.New("name already taken")
+	ErrPublisherLimit = errors.New("room has reached its publisher limit")
+)
+
+// Room is a signaling room backed by an SFU session.
+type Room struct {
+	ID      string
+	Session sfu.Session
+	Config  sfu.WebRTCTransportConfig
+	// OnClose, if set, is called once the room has been removed.
+	OnClose func()
+}
@@ -0,0 +1,14 @@
+package ports
+
+import (
+	"github.com/ownerofglory/webrtc-sfu-demo/internal/core/domain"
+	"time"
+)
+
+type TokenVerifier interface {
+	Verify(token string) (domain.AccessClaims, error)
+}
+
+type TokenIssuer interface {
+	Issue(claims domain.AccessClaims, ttl time.Duration) (string, time.Time, error)
+}
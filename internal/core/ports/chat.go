@@ -0,0 +1,9 @@
+package ports
+
+import "github.com/ownerofglory/webrtc-sfu-demo/internal/core/domain"
+
+type ChatHistory interface {
+	Append(roomID string, msg domain.ChatMessage)
+	History(roomID string) []domain.ChatMessage
+	Clear(roomID string)
+}
@@ -2,5 +2,6 @@ package ports
 
 type NicknameGenerator interface {
 	Generate() string
+	Reserve(name string) bool
 	Release(name string)
 }
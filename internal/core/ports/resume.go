@@ -0,0 +1,8 @@
+package ports
+
+import "github.com/ownerofglory/webrtc-sfu-demo/internal/core/domain"
+
+type ResumeTokenService interface {
+	Issue(clientID, roomID string) (string, error)
+	Verify(token string) (domain.ResumeClaims, error)
+}
@@ -1,6 +1,41 @@
 package ports
 
+import (
+	"github.com/ownerofglory/webrtc-sfu-demo/internal/core/domain"
+	"github.com/pion/ion-sfu/pkg/sfu"
+)
+
 type RoomNameGenerator interface {
 	Generate() string
 	Release(name string)
 }
+
+// RoomMember is a participant tracked by a RoomRegistry.
+type RoomMember interface {
+	MemberID() string
+}
+
+// RoomFactory builds a new room when a RoomRegistry does not know it yet.
+// It may run concurrently for the same room ID; rooms that lose the race
+// are discarded through their OnClose hook.
+type RoomFactory func(roomID string) (*domain.Room, error)
+
+// RoomRegistry keeps track of rooms, their members and their lifetime.
+// A room lives as long as somebody holds a reference acquired via Acquire.
+type RoomRegistry interface {
+	sfu.SessionProvider
+
+	Acquire(roomID string, factory RoomFactory) (*domain.Room, error)
+	Release(roomID string) bool
+	Get(roomID string) (*domain.Room, bool)
+
+	AddMember(roomID string, member RoomMember) error
+	RemoveMember(roomID, memberID string)
+	Member(roomID, memberID string) (RoomMember, bool)
+	Members(roomID string) []RoomMember
+
+	AddPublisher(roomID string, member RoomMember) error
+	RemovePublisher(roomID string, member RoomMember)
+
+	Range(fn func(room *domain.Room) bool)
+}
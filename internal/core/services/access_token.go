@@ -0,0 +1,104 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/ownerofglory/webrtc-sfu-demo/internal/core/domain"
+	"strings"
+	"time"
+)
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ,omitempty"`
+}
+
+type accessTokenService struct {
+	secret []byte
+}
+
+// NewAccessTokenService creates a service issuing and verifying HS256 signed JWT room access tokens.
+func NewAccessTokenService(secret []byte) *accessTokenService {
+	return &accessTokenService{
+		secret: secret,
+	}
+}
+
+// Issue returns a signed token for the claims, valid for ttl from now, and
+// the expiry embedded in it.
+func (s *accessTokenService) Issue(claims domain.AccessClaims, ttl time.Duration) (string, time.Time, error) {
+	now := time.Now()
+	claims.IssuedAt = now.Unix()
+	claims.ExpiresAt = now.Add(ttl).Unix()
+
+	header, err := encodeSegment(jwtHeader{Alg: "HS256", Typ: "JWT"})
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("error marshalling token header: %w", err)
+	}
+	payload, err := encodeSegment(claims)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("error marshalling access claims: %w", err)
+	}
+
+	signed := header + "." + payload
+	return signed + "." + s.sign(signed), time.Unix(claims.ExpiresAt, 0).UTC(), nil
+}
+
+// Verify checks the token signature and expiry and returns its claims.
+// Tokens without a room or with an unknown role are rejected.
+func (s *accessTokenService) Verify(token string) (domain.AccessClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return domain.AccessClaims{}, domain.ErrInvalidToken
+	}
+
+	signed := parts[0] + "." + parts[1]
+	if !hmac.Equal([]byte(parts[2]), []byte(s.sign(signed))) {
+		return domain.AccessClaims{}, domain.ErrInvalidToken
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil || header.Alg != "HS256" {
+		return domain.AccessClaims{}, domain.ErrInvalidToken
+	}
+
+	var claims domain.AccessClaims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return domain.AccessClaims{}, domain.ErrInvalidToken
+	}
+	if claims.Room == "" || !claims.Role.Valid() {
+		return domain.AccessClaims{}, domain.ErrInvalidToken
+	}
+	if claims.ExpiresAt == 0 || time.Now().Unix() >= claims.ExpiresAt {
+		return domain.AccessClaims{}, domain.ErrTokenExpired
+	}
+
+	return claims, nil
+}
+
+func (s *accessTokenService) sign(signed string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(signed))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func encodeSegment(v any) (string, error) {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(payload), nil
+}
+
+func decodeSegment(segment string, v any) error {
+	payload, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(payload, v)
+}
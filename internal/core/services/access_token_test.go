@@ -0,0 +1,129 @@
+package services
+
+import (
+	"errors"
+	"github.com/ownerofglory/webrtc-sfu-demo/internal/core/domain"
+	"strings"
+	"testing"
+	"time"
+)
+
+// signToken builds a token with an arbitrary header and claims, signed with
+// the secret of s.
+func signToken(t *testing.T, s *accessTokenService, header jwtHeader, claims any) string {
+	t.Helper()
+
+	h, err := encodeSegment(header)
+	if err != nil {
+		t.Fatalf("encode header: %v", err)
+	}
+	p, err := encodeSegment(claims)
+	if err != nil {
+		t.Fatalf("encode claims: %v", err)
+	}
+
+	signed := h + "." + p
+	return signed + "." + s.sign(signed)
+}
+
+func TestAccessTokenVerify(t *testing.T) {
+	s := NewAccessTokenService([]byte("secret"))
+	other := NewAccessTokenService([]byte("other"))
+	hs256 := jwtHeader{Alg: "HS256", Typ: "JWT"}
+	exp := time.Now().Add(time.Minute).Unix()
+
+	valid := domain.AccessClaims{Subject: "alice", Room: "r1", Name: "Alice", Role: domain.RoleModerator, ExpiresAt: exp}
+
+	tests := []struct {
+		name    string
+		token   string
+		want    domain.AccessClaims
+		wantErr error
+	}{
+		{
+			name:  "valid",
+			token: signToken(t, s, hs256, valid),
+			want:  valid,
+		},
+		{
+			name:    "bad signature",
+			token:   signToken(t, other, hs256, valid),
+			wantErr: domain.ErrInvalidToken,
+		},
+		{
+			name: "tampered payload",
+			token: func() string {
+				parts := strings.Split(signToken(t, s, hs256, valid), ".")
+				forged := signToken(t, s, hs256, domain.AccessClaims{Room: "r2", Role: domain.RoleModerator, ExpiresAt: exp})
+				return parts[0] + "." + strings.Split(forged, ".")[1] + "." + parts[2]
+			}(),
+			wantErr: domain.ErrInvalidToken,
+		},
+		{
+			name:    "wrong alg",
+			token:   signToken(t, s, jwtHeader{Alg: "none"}, valid),
+			wantErr: domain.ErrInvalidToken,
+		},
+		{
+			name:    "malformed",
+			token:   "not-a-token",
+			wantErr: domain.ErrInvalidToken,
+		},
+		{
+			name:    "expired",
+			token:   signToken(t, s, hs256, domain.AccessClaims{Room: "r1", Role: domain.RolePublisher, ExpiresAt: time.Now().Add(-time.Second).Unix()}),
+			wantErr: domain.ErrTokenExpired,
+		},
+		{
+			name:    "missing expiry",
+			token:   signToken(t, s, hs256, domain.AccessClaims{Room: "r1", Role: domain.RolePublisher}),
+			wantErr: domain.ErrTokenExpired,
+		},
+		{
+			name:    "missing room",
+			token:   signToken(t, s, hs256, domain.AccessClaims{Role: domain.RolePublisher, ExpiresAt: exp}),
+			wantErr: domain.ErrInvalidToken,
+		},
+		{
+			name:    "invalid role",
+			token:   signToken(t, s, hs256, domain.AccessClaims{Room: "r1", Role: "admin", ExpiresAt: exp}),
+			wantErr: domain.ErrInvalidToken,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.Verify(tt.token)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Verify() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Verify() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAccessTokenIssue(t *testing.T) {
+	s := NewAccessTokenService([]byte("secret"))
+	claims := domain.AccessClaims{Subject: "bob", Room: "r1", Role: domain.RoleSubscriber}
+
+	token, expiresAt, err := s.Issue(claims, time.Minute)
+	if err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+
+	got, err := s.Verify(token)
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if got.Subject != claims.Subject || got.Room != claims.Room || got.Role != claims.Role {
+		t.Errorf("Verify() = %+v, want claims of %+v", got, claims)
+	}
+	if got.ExpiresAt != expiresAt.Unix() {
+		t.Errorf("token expires at %d, Issue() reported %d", got.ExpiresAt, expiresAt.Unix())
+	}
+	if got.ExpiresAt-got.IssuedAt != int64(time.Minute/time.Second) {
+		t.Errorf("token valid for %ds, want 60s", got.ExpiresAt-got.IssuedAt)
+	}
+}
@@ -0,0 +1,54 @@
+package services
+
+import (
+	"github.com/ownerofglory/webrtc-sfu-demo/internal/core/domain"
+	"sync"
+)
+
+type chatHistory struct {
+	mu    sync.RWMutex
+	size  int
+	rooms map[string][]domain.ChatMessage
+}
+
+// NewChatHistory creates an in-memory chat history keeping the last size messages per room.
+func NewChatHistory(size int) *chatHistory {
+	return &chatHistory{
+		size:  size,
+		rooms: make(map[string][]domain.ChatMessage),
+	}
+}
+
+// Append stores a message, evicting the oldest one once the room history is full.
+func (c *chatHistory) Append(roomID string, msg domain.ChatMessage) {
+	if c.size <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	history := append(c.rooms[roomID], msg)
+	if len(history) > c.size {
+		history = history[len(history)-c.size:]
+	}
+	c.rooms[roomID] = history
+}
+
+// History returns a copy of the room history, oldest message first.
+func (c *chatHistory) History(roomID string) []domain.ChatMessage {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	history := make([]domain.ChatMessage, len(c.rooms[roomID]))
+	copy(history, c.rooms[roomID])
+
+	return history
+}
+
+// Clear drops the history of a room.
+func (c *chatHistory) Clear(roomID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.rooms, roomID)
+}
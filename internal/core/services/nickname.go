@@ -7,8 +7,9 @@ import (
 )
 
 type nicknameGenerator struct {
-	mu    sync.Mutex
-	inUse map[string]struct{}
+	mu       sync.Mutex
+	inUse    map[string]struct{}
+	overflow uint64
 }
 
 var adjectives = []string{
@@ -88,22 +89,24 @@ func (g *nicknameGenerator) Generate() string {
 	g.mu.Lock()
 	defer g.mu.Unlock()
 
-	maxAttempts := len(adjectives) * len(animals)
-	for i := 0; i < maxAttempts; i++ {
-		adj := adjectives[rand.IntN(len(adjectives))]
-		animal := animals[rand.IntN(len(animals))]
-		name := fmt.Sprintf("%s_%s", adj, animal)
+	// Walk all combinations from a random start, so a free one is found
+	// whenever there is one.
+	total := len(adjectives) * len(animals)
+	start := rand.IntN(total)
+	for i := 0; i < total; i++ {
+		n := (start + i) % total
+		name := fmt.Sprintf("%s_%s", adjectives[n/len(animals)], animals[n%len(animals)])
 		if _, exists := g.inUse[name]; !exists {
 			g.inUse[name] = struct{}{}
 			return name
 		}
 	}
 
-	// fallback: append random number if exhausted
+	// fallback: the counter never repeats, so the name cannot be generated
+	// twice. Reserve may still have taken it, so it is checked as well.
 	for {
-		adj := adjectives[rand.IntN(len(adjectives))]
-		animal := animals[rand.IntN(len(animals))]
-		name := fmt.Sprintf("%s_%s_%d", adj, animal, rand.IntN(1000))
+		g.overflow++
+		name := fmt.Sprintf("%s_%s_%d", adjectives[rand.IntN(len(adjectives))], animals[rand.IntN(len(animals))], g.overflow)
 		if _, exists := g.inUse[name]; !exists {
 			g.inUse[name] = struct{}{}
 			return name
@@ -111,6 +114,20 @@ func (g *nicknameGenerator) Generate() string {
 	}
 }
 
+// Reserve marks a nickname chosen elsewhere as in use. It reports false if
+// the nickname is already taken.
+func (g *nicknameGenerator) Reserve(name string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if _, exists := g.inUse[name]; exists {
+		return false
+	}
+	g.inUse[name] = struct{}{}
+
+	return true
+}
+
 // Release frees a nickname for reuse.
 func (g *nicknameGenerator) Release(name string) {
 	g.mu.Lock()
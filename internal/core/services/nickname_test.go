@@ -0,0 +1,24 @@
+package services
+
+import "testing"
+
+func TestNicknameGeneratorExhaustion(t *testing.T) {
+	g := NewNicknameGenerator()
+	total := len(adjectives) * len(animals)
+
+	seen := make(map[string]struct{}, total)
+	for i := 0; i < total; i++ {
+		seen[g.Generate()] = struct{}{}
+	}
+	if len(seen) != total {
+		t.Fatalf("%d unique nicknames out of %d", len(seen), total)
+	}
+
+	if !g.Reserve("happy_fox_1") {
+		t.Fatal("Reserve() of a free name failed")
+	}
+	name := g.Generate()
+	if _, dup := seen[name]; dup || name == "happy_fox_1" {
+		t.Errorf("Generate() = %q, which is already in use", name)
+	}
+}
@@ -0,0 +1,69 @@
+package services
+
+import (
+	"errors"
+	"github.com/ownerofglory/webrtc-sfu-demo/internal/core/domain"
+	"strings"
+	"testing"
+)
+
+func TestResumeToken(t *testing.T) {
+	s := NewResumeTokenService([]byte("secret"))
+
+	token, err := s.Issue("client", "room")
+	if err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+	encoded, sig, _ := strings.Cut(token, ".")
+
+	forged, err := s.Issue("other", "room")
+	if err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+	forgedPayload, _, _ := strings.Cut(forged, ".")
+
+	tests := []struct {
+		name     string
+		verifier *resumeTokenService
+		token    string
+		wantErr  error
+	}{
+		{name: "round trip", verifier: s, token: token},
+		{name: "tampered payload", verifier: s, token: forgedPayload + "." + sig, wantErr: domain.ErrInvalidToken},
+		{name: "tampered signature", verifier: s, token: encoded + "." + sig[1:], wantErr: domain.ErrInvalidToken},
+		{name: "wrong secret", verifier: NewResumeTokenService([]byte("other")), token: token, wantErr: domain.ErrInvalidToken},
+		{name: "malformed", verifier: s, token: "no-separator", wantErr: domain.ErrInvalidToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := tt.verifier.Verify(tt.token)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Verify() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if claims.ClientID != "client" || claims.RoomID != "room" {
+				t.Errorf("Verify() = %+v, want client in room", claims)
+			}
+		})
+	}
+}
+
+func TestResumeTokenNonce(t *testing.T) {
+	s := NewResumeTokenService([]byte("secret"))
+
+	a, err := s.Issue("client", "room")
+	if err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+	b, err := s.Issue("client", "room")
+	if err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+
+	if a == b {
+		t.Error("two tokens for the same slot are equal")
+	}
+}
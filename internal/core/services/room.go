@@ -1,13 +1,15 @@
 package services
 
 import (
+	"fmt"
 	"math/rand/v2"
 	"sync"
 )
 
 type roomGenerator struct {
-	mu    sync.Mutex
-	inUse map[string]struct{}
+	mu       sync.Mutex
+	inUse    map[string]struct{}
+	overflow uint64
 }
 
 var colors = []string{
@@ -46,21 +48,32 @@ func NewRoomGenerator() *roomGenerator {
 	}
 }
 
-// Generate returns a unique room name like "paris-crimson"
+// Generate returns a unique room name like "paris-crimson". Once every
+// combination is taken, names get a counter suffix like "paris-crimson-3".
 func (g *roomGenerator) Generate() string {
 	g.mu.Lock()
 	defer g.mu.Unlock()
 
-	for {
-		city := cities[rand.IntN(len(cities))]
-		color := colors[rand.IntN(len(colors))]
-		room := city + "-" + color
+	// Walk all combinations from a random start, so a free one is found
+	// whenever there is one.
+	total := len(cities) * len(colors)
+	start := rand.IntN(total)
+	for i := 0; i < total; i++ {
+		n := (start + i) % total
+		room := cities[n/len(colors)] + "-" + colors[n%len(colors)]
 
 		if _, ok := g.inUse[room]; !ok {
 			g.inUse[room] = struct{}{}
 			return room
 		}
 	}
+
+	// fallback: the counter never repeats, so the name cannot be in use
+	g.overflow++
+	room := fmt.Sprintf("%s-%s-%d", cities[rand.IntN(len(cities))], colors[rand.IntN(len(colors))], g.overflow)
+	g.inUse[room] = struct{}{}
+
+	return room
 }
 
 // Release frees a room name for reuse.
@@ -0,0 +1,268 @@
+package services
+
+import (
+	"fmt"
+	"github.com/ownerofglory/webrtc-sfu-demo/internal/core/domain"
+	"github.com/ownerofglory/webrtc-sfu-demo/internal/core/ports"
+	"github.com/pion/ion-sfu/pkg/sfu"
+	"log/slog"
+	"sync"
+)
+
+type roomEntry struct {
+	room       *domain.Room
+	refs       int
+	members    map[string]ports.RoomMember
+	publishers map[string]ports.RoomMember
+}
+
+type roomRegistry struct {
+	mu            sync.RWMutex
+	rooms         map[string]*roomEntry
+	members       int
+	maxPerRoom    int
+	maxPublishers int
+	maxTotal      int
+}
+
+// NewRoomRegistry creates an empty room registry. maxPerRoom limits the
+// members of a single room, maxPublishers the publishers of a single room
+// and maxTotal the members across all rooms; zero means unlimited.
+func NewRoomRegistry(maxPerRoom, maxPublishers, maxTotal int) *roomRegistry {
+	return &roomRegistry{
+		rooms:         make(map[string]*roomEntry),
+		maxPerRoom:    maxPerRoom,
+		maxPublishers: maxPublishers,
+		maxTotal:      maxTotal,
+	}
+}
+
+// Acquire returns the room with the given ID, creating it with factory if it
+// does not exist yet, and takes a reference on it. Every successful call
+// must be paired with a call to Release.
+//
+// The factory may be slow, so it runs without holding the registry lock. If
+// another caller created the room in the meantime, the freshly built room
+// is closed and the existing one is returned.
+func (r *roomRegistry) Acquire(roomID string, factory ports.RoomFactory) (*domain.Room, error) {
+	if room, ok := r.ref(roomID); ok {
+		return room, nil
+	}
+
+	room, err := factory(roomID)
+	if err != nil {
+		return nil, fmt.Errorf("error creating room %s: %w", roomID, err)
+	}
+
+	r.mu.Lock()
+	if e, ok := r.rooms[roomID]; ok {
+		e.refs++
+		r.mu.Unlock()
+
+		if room.OnClose != nil {
+			room.OnClose()
+		}
+		return e.room, nil
+	}
+
+	r.rooms[roomID] = &roomEntry{
+		room:       room,
+		refs:       1,
+		members:    make(map[string]ports.RoomMember),
+		publishers: make(map[string]ports.RoomMember),
+	}
+	r.mu.Unlock()
+	slog.Debug("Created new room", "room", roomID)
+
+	return room, nil
+}
+
+// ref takes a reference on an existing room.
+func (r *roomRegistry) ref(roomID string) (*domain.Room, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	e, ok := r.rooms[roomID]
+	if !ok {
+		return nil, false
+	}
+	e.refs++
+
+	return e.room, true
+}
+
+// Release drops a reference taken by Acquire. The room is removed and its
+// OnClose hook called once the last reference is gone; the return value
+// reports whether that happened.
+func (r *roomRegistry) Release(roomID string) bool {
+	r.mu.Lock()
+	e, ok := r.rooms[roomID]
+	if !ok {
+		r.mu.Unlock()
+		return false
+	}
+
+	e.refs--
+	if e.refs > 0 {
+		r.mu.Unlock()
+		return false
+	}
+
+	delete(r.rooms, roomID)
+	r.members -= len(e.members)
+	r.mu.Unlock()
+	slog.Debug("Removed room", "room", roomID)
+
+	if e.room.OnClose != nil {
+		e.room.OnClose()
+	}
+
+	return true
+}
+
+// Get returns the room with the given ID.
+func (r *roomRegistry) Get(roomID string) (*domain.Room, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	e, ok := r.rooms[roomID]
+	if !ok {
+		return nil, false
+	}
+
+	return e.room, true
+}
+
+// AddMember adds a member to an existing room, enforcing the member limits.
+func (r *roomRegistry) AddMember(roomID string, member ports.RoomMember) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	e, ok := r.rooms[roomID]
+	if !ok {
+		return domain.ErrRoomNotFound
+	}
+
+	if _, exists := e.members[member.MemberID()]; exists {
+		return domain.ErrMemberExists
+	}
+	if r.maxPerRoom > 0 && len(e.members) >= r.maxPerRoom {
+		return domain.ErrRoomFull
+	}
+	if r.maxTotal > 0 && r.members >= r.maxTotal {
+		return domain.ErrServerFull
+	}
+	e.members[member.MemberID()] = member
+	r.members++
+
+	return nil
+}
+
+// RemoveMember removes a member from a room. Removing an unknown member is a no-op.
+func (r *roomRegistry) RemoveMember(roomID, memberID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if e, ok := r.rooms[roomID]; ok {
+		if _, exists := e.members[memberID]; exists {
+			delete(e.members, memberID)
+			delete(e.publishers, memberID)
+			r.members--
+		}
+	}
+}
+
+// AddPublisher reserves a publisher slot in a room for a member, enforcing
+// the publisher limit. Reserving a slot the member already holds is a no-op.
+func (r *roomRegistry) AddPublisher(roomID string, member ports.RoomMember) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	e, ok := r.rooms[roomID]
+	if !ok {
+		return domain.ErrRoomNotFound
+	}
+
+	if p, exists := e.publishers[member.MemberID()]; exists && p == member {
+		return nil
+	}
+	if r.maxPublishers > 0 && len(e.publishers) >= r.maxPublishers {
+		return domain.ErrPublisherLimit
+	}
+	e.publishers[member.MemberID()] = member
+
+	return nil
+}
+
+// RemovePublisher frees the publisher slot held by a member. A slot that has
+// been taken over by another member with the same ID is left alone.
+func (r *roomRegistry) RemovePublisher(roomID string, member ports.RoomMember) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if e, ok := r.rooms[roomID]; ok {
+		if p, exists := e.publishers[member.MemberID()]; exists && p == member {
+			delete(e.publishers, member.MemberID())
+		}
+	}
+}
+
+// Member returns a single member of a room.
+func (r *roomRegistry) Member(roomID, memberID string) (ports.RoomMember, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	e, ok := r.rooms[roomID]
+	if !ok {
+		return nil, false
+	}
+
+	m, ok := e.members[memberID]
+	return m, ok
+}
+
+// Members returns a snapshot of the members of a room.
+func (r *roomRegistry) Members(roomID string) []ports.RoomMember {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	e, ok := r.rooms[roomID]
+	if !ok {
+		return nil
+	}
+
+	members := make([]ports.RoomMember, 0, len(e.members))
+	for _, m := range e.members {
+		members = append(members, m)
+	}
+
+	return members
+}
+
+// Range calls fn for a snapshot of all rooms until fn returns false.
+func (r *roomRegistry) Range(fn func(room *domain.Room) bool) {
+	r.mu.RLock()
+	rooms := make([]*domain.Room, 0, len(r.rooms))
+	for _, e := range r.rooms {
+		rooms = append(rooms, e.room)
+	}
+	r.mu.RUnlock()
+
+	for _, room := range rooms {
+		if !fn(room) {
+			return
+		}
+	}
+}
+
+// GetSession implements sfu.SessionProvider so that peers can join rooms
+// held by the registry.
+func (r *roomRegistry) GetSession(sid string) (sfu.Session, sfu.WebRTCTransportConfig) {
+	room, ok := r.Get(sid)
+	if !ok {
+		slog.Warn("room not found", "room", sid)
+		return nil, sfu.WebRTCTransportConfig{}
+	}
+
+	return room.Session, room.Config
+}
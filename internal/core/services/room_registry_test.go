@@ -0,0 +1,251 @@
+package services
+
+import (
+	"errors"
+	"github.com/ownerofglory/webrtc-sfu-demo/internal/core/domain"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+type testMember string
+
+func (m testMember) MemberID() string {
+	return string(m)
+}
+
+// countingFactory returns a room factory whose rooms count their OnClose calls.
+func countingFactory(closed *atomic.Int32) func(roomID string) (*domain.Room, error) {
+	return func(roomID string) (*domain.Room, error) {
+		return &domain.Room{
+			ID: roomID,
+			OnClose: func() {
+				closed.Add(1)
+			},
+		}, nil
+	}
+}
+
+func TestRoomRegistryRefCount(t *testing.T) {
+	r := NewRoomRegistry(0, 0, 0)
+	var closed atomic.Int32
+
+	first, err := r.Acquire("room", countingFactory(&closed))
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	second, err := r.Acquire("room", func(string) (*domain.Room, error) {
+		t.Fatal("factory called for an existing room")
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	if first != second {
+		t.Fatal("Acquire() returned a different room for the same ID")
+	}
+
+	if r.Release("room") {
+		t.Error("Release() removed the room while a reference was left")
+	}
+	if _, ok := r.Get("room"); !ok {
+		t.Error("room gone while a reference was left")
+	}
+	if !r.Release("room") {
+		t.Error("Release() kept the room after the last reference")
+	}
+	if _, ok := r.Get("room"); ok {
+		t.Error("room still registered after the last reference")
+	}
+	if r.Release("room") {
+		t.Error("Release() of an unknown room reported a removal")
+	}
+
+	if got := closed.Load(); got != 1 {
+		t.Errorf("OnClose called %d times, want 1", got)
+	}
+}
+
+func TestRoomRegistryFactoryError(t *testing.T) {
+	r := NewRoomRegistry(0, 0, 0)
+	errFactory := errors.New("no config")
+
+	_, err := r.Acquire("room", func(string) (*domain.Room, error) {
+		return nil, errFactory
+	})
+	if !errors.Is(err, errFactory) {
+		t.Fatalf("Acquire() error = %v, want %v", err, errFactory)
+	}
+	if _, ok := r.Get("room"); ok {
+		t.Error("room registered although the factory failed")
+	}
+}
+
+func TestRoomRegistryConcurrentCreate(t *testing.T) {
+	r := NewRoomRegistry(0, 0, 0)
+	var closed atomic.Int32
+
+	// Both factories have to be running before either returns, so that both
+	// callers miss the existing room and race to register theirs.
+	var entered sync.WaitGroup
+	entered.Add(2)
+	factory := func(roomID string) (*domain.Room, error) {
+		entered.Done()
+		entered.Wait()
+		return countingFactory(&closed)(roomID)
+	}
+
+	rooms := make([]*domain.Room, 2)
+	var wg sync.WaitGroup
+	for i := range rooms {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			room, err := r.Acquire("room", factory)
+			if err != nil {
+				t.Errorf("Acquire() error = %v", err)
+			}
+			rooms[i] = room
+		}()
+	}
+	wg.Wait()
+
+	if rooms[0] != rooms[1] {
+		t.Fatal("concurrent Acquire() returned different rooms")
+	}
+	if got := closed.Load(); got != 1 {
+		t.Fatalf("discarded rooms closed %d times, want 1", got)
+	}
+
+	r.Release("room")
+	if !r.Release("room") {
+		t.Error("room kept after both references were released")
+	}
+	if got := closed.Load(); got != 2 {
+		t.Errorf("OnClose called %d times in total, want 2", got)
+	}
+}
+
+func TestRoomRegistryMemberLimits(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxPerRoom int
+		maxTotal   int
+		members    map[string][]string
+		join       string
+		room       string
+		wantErr    error
+	}{
+		{
+			name:    "unlimited",
+			members: map[string][]string{"a": {"m1", "m2"}},
+			join:    "m3",
+			room:    "a",
+		},
+		{
+			name:    "duplicate member",
+			members: map[string][]string{"a": {"m1"}},
+			join:    "m1",
+			room:    "a",
+			wantErr: domain.ErrMemberExists,
+		},
+		{
+			name:    "unknown room",
+			join:    "m1",
+			room:    "missing",
+			wantErr: domain.ErrRoomNotFound,
+		},
+		{
+			name:       "room full",
+			maxPerRoom: 2,
+			members:    map[string][]string{"a": {"m1", "m2"}},
+			join:       "m3",
+			room:       "a",
+			wantErr:    domain.ErrRoomFull,
+		},
+		{
+			name:     "server full",
+			maxTotal: 2,
+			members:  map[string][]string{"a": {"m1"}, "b": {"m2"}},
+			join:     "m3",
+			room:     "a",
+			wantErr:  domain.ErrServerFull,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRoomRegistry(tt.maxPerRoom, 0, tt.maxTotal)
+			var closed atomic.Int32
+			for roomID, members := range tt.members {
+				if _, err := r.Acquire(roomID, countingFactory(&closed)); err != nil {
+					t.Fatalf("Acquire() error = %v", err)
+				}
+				for _, m := range members {
+					if err := r.AddMember(roomID, testMember(m)); err != nil {
+						t.Fatalf("AddMember(%s) error = %v", m, err)
+					}
+				}
+			}
+
+			err := r.AddMember(tt.room, testMember(tt.join))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("AddMember() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRoomRegistryReleaseFreesMembers(t *testing.T) {
+	r := NewRoomRegistry(0, 0, 1)
+	var closed atomic.Int32
+
+	if _, err := r.Acquire("a", countingFactory(&closed)); err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	if err := r.AddMember("a", testMember("m1")); err != nil {
+		t.Fatalf("AddMember() error = %v", err)
+	}
+	r.Release("a")
+
+	if _, err := r.Acquire("b", countingFactory(&closed)); err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	if err := r.AddMember("b", testMember("m2")); err != nil {
+		t.Errorf("AddMember() error = %v after the only other room was released", err)
+	}
+}
+
+func TestRoomRegistryPublisherLimit(t *testing.T) {
+	r := NewRoomRegistry(0, 1, 0)
+	var closed atomic.Int32
+
+	if _, err := r.Acquire("room", countingFactory(&closed)); err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	for _, m := range []string{"m1", "m2"} {
+		if err := r.AddMember("room", testMember(m)); err != nil {
+			t.Fatalf("AddMember(%s) error = %v", m, err)
+		}
+	}
+
+	if err := r.AddPublisher("room", testMember("m1")); err != nil {
+		t.Fatalf("AddPublisher(m1) error = %v", err)
+	}
+	if err := r.AddPublisher("room", testMember("m1")); err != nil {
+		t.Errorf("AddPublisher(m1) again error = %v, want nil", err)
+	}
+	if err := r.AddPublisher("room", testMember("m2")); !errors.Is(err, domain.ErrPublisherLimit) {
+		t.Errorf("AddPublisher(m2) error = %v, want %v", err, domain.ErrPublisherLimit)
+	}
+
+	r.RemovePublisher("room", testMember("m1"))
+	if err := r.AddPublisher("room", testMember("m2")); err != nil {
+		t.Errorf("AddPublisher(m2) error = %v after m1 stopped publishing", err)
+	}
+
+	r.RemoveMember("room", "m2")
+	if err := r.AddPublisher("room", testMember("m1")); err != nil {
+		t.Errorf("AddPublisher(m1) error = %v after m2 left", err)
+	}
+}
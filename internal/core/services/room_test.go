@@ -0,0 +1,36 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRoomGeneratorExhaustion(t *testing.T) {
+	g := NewRoomGenerator()
+	total := len(cities) * len(colors)
+
+	seen := make(map[string]struct{}, total)
+	for i := 0; i < total; i++ {
+		room := g.Generate()
+		if _, dup := seen[room]; dup {
+			t.Fatalf("Generate() returned %q twice", room)
+		}
+		if strings.Count(room, "-") != 1 {
+			t.Fatalf("Generate() = %q with free combinations left", room)
+		}
+		seen[room] = struct{}{}
+	}
+
+	for i := 0; i < 3; i++ {
+		room := g.Generate()
+		if _, dup := seen[room]; dup {
+			t.Fatalf("Generate() returned %q twice", room)
+		}
+		seen[room] = struct{}{}
+	}
+
+	g.Release("paris-crimson")
+	if room := g.Generate(); room != "paris-crimson" {
+		t.Errorf("Generate() = %q, want the released name", room)
+	}
+}
@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"errors"
+	"github.com/ownerofglory/webrtc-sfu-demo/internal/core/domain"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+const (
+	accessTokenParam = "token"
+
+	// wsSubprotocol is selected by the server whenever the client offers it.
+	// Browsers cannot set headers on websocket requests, so a client may
+	// pass its access token as an additional subprotocol prefixed with
+	// accessTokenProtocolPrefix. It must offer wsSubprotocol as well, since
+	// the token protocol is never selected.
+	wsSubprotocol             = "webrtc-sfu"
+	accessTokenProtocolPrefix = "access-token."
+)
+
+// accessToken returns the access token of the request, taken from the
+// query or from the websocket subprotocols.
+func accessToken(req *http.Request) string {
+	if token := req.URL.Query().Get(accessTokenParam); token != "" {
+		return token
+	}
+
+	for _, protocol := range websocketProtocols(req) {
+		if token, ok := strings.CutPrefix(protocol, accessTokenProtocolPrefix); ok {
+			return token
+		}
+	}
+
+	return ""
+}
+
+func websocketProtocols(req *http.Request) []string {
+	var protocols []string
+	for _, header := range req.Header.Values("Sec-WebSocket-Protocol") {
+		for _, protocol := range strings.Split(header, ",") {
+			if protocol = strings.TrimSpace(protocol); protocol != "" {
+				protocols = append(protocols, protocol)
+			}
+		}
+	}
+
+	return protocols
+}
+
+// authenticate verifies the access token of the request against the
+// requested room. Without a token verifier every client joins as a
+// publisher. On failure the HTTP error has been written and false is
+// returned.
+func (h *wsHandler) authenticate(rw http.ResponseWriter, req *http.Request) (domain.AccessClaims, bool) {
+	roomID := req.PathValue("roomId")
+	if h.tokenVerifier == nil {
+		return domain.AccessClaims{Room: roomID, Role: domain.RolePublisher}, true
+	}
+
+	token := accessToken(req)
+	if token == "" {
+		http.Error(rw, "access token required", http.StatusUnauthorized)
+		return domain.AccessClaims{}, false
+	}
+
+	claims, err := h.tokenVerifier.Verify(token)
+	if err != nil {
+		slog.Warn("Rejected access token", "room", roomID, "err", err)
+		if errors.Is(err, domain.ErrTokenExpired) {
+			http.Error(rw, "access token expired", http.StatusUnauthorized)
+		} else {
+			http.Error(rw, "invalid access token", http.StatusUnauthorized)
+		}
+		return domain.AccessClaims{}, false
+	}
+
+	if claims.Room != roomID {
+		slog.Warn("Access token not valid for room", "room", roomID, "tokenRoom", claims.Room)
+		http.Error(rw, "access token not valid for this room", http.StatusForbidden)
+		return domain.AccessClaims{}, false
+	}
+
+	return claims, true
+}
@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"fmt"
+	"github.com/ownerofglory/webrtc-sfu-demo/internal/core/domain"
+	"log/slog"
+	"time"
+	"unicode/utf8"
+)
+
+const webrtcChat WebRTCSignalingMessageType = "chat"
+
+// handleChat stamps a chat message with the sender and the server time,
+// stores it in the room history and sends it to every member of the room.
+// The copy sent back to the sender carries the request ID as an ack.
+func (h *wsHandler) handleChat(c *webRTCClientConn, id string, signal *WebRTCSignalingMessage) {
+	if !h.acceptChat(c, id, signal.Text) {
+		return
+	}
+
+	msg := domain.ChatMessage{
+		From:   string(c.id),
+		Text:   signal.Text,
+		SentAt: time.Now().UTC(),
+	}
+	h.chatHistory.Append(c.roomID, msg)
+	h.broadcast(c.roomID, c.id, chatMessage(c.roomID, msg))
+
+	ack := chatMessage(c.roomID, msg)
+	ack.ID = id
+	if err := c.send(ack); err != nil {
+		slog.Warn("Error acknowledging chat message", "client", c.id, "err", err)
+	}
+}
+
+// acceptChat rejects empty chat text and text above the configured length
+// with an error to the sender. It reports whether the text may be sent.
+func (h *wsHandler) acceptChat(c *webRTCClientConn, id, text string) bool {
+	if text == "" {
+		c.sendError(id, errCodeChatRejected, "chat message is empty", fmt.Errorf("empty chat message"))
+		return false
+	}
+	if length := utf8.RuneCountInString(text); h.chatMaxLength > 0 && length > h.chatMaxLength {
+		c.sendError(id, errCodeChatRejected, "chat message is too long",
+			fmt.Errorf("chat message of %d characters exceeds limit of %d", length, h.chatMaxLength))
+		return false
+	}
+	return true
+}
+
+// sendChatHistory replays the room history to the client.
+func (h *wsHandler) sendChatHistory(c *webRTCClientConn) {
+	for _, msg := range h.chatHistory.History(c.roomID) {
+		if err := c.send(chatMessage(c.roomID, msg)); err != nil {
+			slog.Error("Error sending chat history", "client", c.id, "err", err)
+			return
+		}
+	}
+}
+
+func chatMessage(roomID string, msg domain.ChatMessage) *WebRTCClientMessage {
+	sentAt := msg.SentAt
+	return &WebRTCClientMessage{
+		RoomID:       roomID,
+		OriginPeerID: WebRTCClientID(msg.From),
+		SignalingMessage: &WebRTCSignalingMessage{
+			MessageType: webrtcChat,
+			Text:        msg.Text,
+			SentAt:      &sentAt,
+		},
+	}
+}
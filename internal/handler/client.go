@@ -0,0 +1,155 @@
+package handler
+
+import (
+	"errors"
+	"github.com/gorilla/websocket"
+	"github.com/ownerofglory/webrtc-sfu-demo/internal/core/domain"
+	"github.com/pion/ion-sfu/pkg/sfu"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	errConnClosed     = errors.New("connection closed")
+	errWriteQueueFull = errors.New("write queue full")
+)
+
+// webRTCClientConn is a single signaling connection. All writes to the
+// underlying websocket happen in writePump; other goroutines enqueue
+// messages via send.
+type webRTCClientConn struct {
+	conn           *websocket.Conn
+	writeTimeout   time.Duration
+	dropSlow       bool
+	id             WebRTCClientID
+	roomID         string
+	role           domain.Role
+	identity       string
+	displayName    string
+	resumeToken    string
+	closedByClient atomic.Bool
+	evicted        atomic.Bool
+	replaced       atomic.Bool
+	leaving        atomic.Bool
+	restarting     atomic.Bool
+	publishing     atomic.Bool
+	waiting        atomic.Bool
+	connCloseOnce  sync.Once
+	peerMx         sync.RWMutex
+	sfuPeer        *sfu.PeerLocal
+	tracksMx       sync.Mutex
+	tracks         map[string]*WebRTCTrackMeta
+	mutedTracks    map[string]struct{}
+	writeCh        chan *WebRTCClientMessage
+	done           chan struct{}
+	writerDone     chan struct{}
+	// admitted is closed when a moderator lets the client out of the lobby,
+	// ready once the client has entered the room and joined the SFU.
+	admitted chan struct{}
+	ready    chan struct{}
+}
+
+// MemberID implements ports.RoomMember.
+func (c *webRTCClientConn) MemberID() string {
+	return string(c.id)
+}
+
+// peer returns the current SFU peer of the client.
+func (c *webRTCClientConn) peer() *sfu.PeerLocal {
+	c.peerMx.RLock()
+	defer c.peerMx.RUnlock()
+	return c.sfuPeer
+}
+
+// setPeer replaces the SFU peer of the client.
+func (c *webRTCClientConn) setPeer(p *sfu.PeerLocal) {
+	c.peerMx.Lock()
+	defer c.peerMx.Unlock()
+	c.sfuPeer = p
+}
+
+// send enqueues a message for the client. It is safe for concurrent use.
+// If the queue is full the message is dropped or the connection is closed,
+// depending on the slow client policy.
+func (c *webRTCClientConn) send(msg *WebRTCClientMessage) error {
+	select {
+	case <-c.done:
+		return errConnClosed
+	default:
+	}
+
+	select {
+	case c.writeCh <- msg:
+		return nil
+	case <-c.done:
+		return errConnClosed
+	default:
+	}
+
+	if c.dropSlow {
+		slog.Warn("Write queue full, dropping message", "client", c.id)
+		return errWriteQueueFull
+	}
+
+	slog.Warn("Write queue full, disconnecting slow client", "client", c.id)
+	c.close()
+
+	return errWriteQueueFull
+}
+
+// close signals the writer to flush pending messages and stop. It is safe to call multiple times.
+func (c *webRTCClientConn) close() {
+	c.connCloseOnce.Do(func() {
+		close(c.done)
+	})
+}
+
+// writePump is the only goroutine writing to the websocket. It sends queued
+// messages and pings the client every pingInterval.
+func (c *webRTCClientConn) writePump(pingInterval time.Duration) {
+	defer close(c.writerDone)
+
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			c.flush()
+			return
+		case msg := <-c.writeCh:
+			_ = c.conn.SetWriteDeadline(time.Now().Add(c.writeTimeout))
+			if err := c.conn.WriteJSON(msg); err != nil {
+				slog.Warn("Error writing to client", "client", c.id, "err", err)
+				c.close()
+				return
+			}
+		case <-ticker.C:
+			_ = c.conn.SetWriteDeadline(time.Now().Add(c.writeTimeout))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				slog.Warn("Error pinging client", "client", c.id, "err", err)
+				c.close()
+				return
+			}
+		}
+	}
+}
+
+// flush writes whatever is still queued, bounded by a single write timeout,
+// and sends a close frame.
+func (c *webRTCClientConn) flush() {
+	_ = c.conn.SetWriteDeadline(time.Now().Add(c.writeTimeout))
+	for {
+		select {
+		case msg := <-c.writeCh:
+			if err := c.conn.WriteJSON(msg); err != nil {
+				return
+			}
+		default:
+			_ = c.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+			return
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package handler
+
+import (
+	"fmt"
+	"log/slog"
+)
+
+const webrtcControl WebRTCSignalingMessageType = "control"
+
+type (
+	WebRTCControlAction string
+
+	// WebRTCControl is a moderator request acting on the room or on one of
+	// its members.
+	WebRTCControl struct {
+		Action   WebRTCControlAction `json:"action"`
+		Peer     WebRTCClientID      `json:"peer,omitempty"`
+		StreamID string              `json:"streamId,omitempty"`
+		TrackID  string              `json:"trackId,omitempty"`
+	}
+)
+
+const (
+	controlKick    WebRTCControlAction = "kick"
+	controlMute    WebRTCControlAction = "mute"
+	controlUnmute  WebRTCControlAction = "unmute"
+	controlEndRoom WebRTCControlAction = "end-room"
+	controlLock    WebRTCControlAction = "lock"
+	controlUnlock  WebRTCControlAction = "unlock"
+	controlAdmit   WebRTCControlAction = "admit"
+	controlDeny    WebRTCControlAction = "deny"
+)
+
+// handleControl runs a control request of a moderator. Successful requests
+// are acknowledged by echoing them back to the sender.
+func (h *wsHandler) handleControl(c *webRTCClientConn, id string, control *WebRTCControl) {
+	if !c.role.CanModerate() {
+		c.sendError(id, errCodeForbidden, "only moderators may send control messages",
+			fmt.Errorf("control message from role %s", c.role))
+		return
+	}
+	if control == nil {
+		c.sendError(id, errCodeInvalidMessage, "control message without control payload",
+			fmt.Errorf("missing control payload"))
+		return
+	}
+
+	var err error
+	switch control.Action {
+	case controlKick:
+		err = h.kick(c, control.Peer)
+	case controlMute, controlUnmute:
+		err = h.setTrackMuted(c, control.Peer, control.StreamID, control.TrackID, control.Action == controlMute)
+	case controlLock, controlUnlock:
+		h.setLocked(c, control.Action == controlLock)
+	case controlAdmit:
+		err = h.admit(c.roomID, control.Peer)
+	case controlDeny:
+		err = h.deny(c, control.Peer)
+	case controlEndRoom:
+		// The sender is evicted as well, so the notice it receives is the ack.
+		h.endRoom(c, id)
+		return
+	default:
+		err = fmt.Errorf("unknown control action %q", control.Action)
+	}
+	if err != nil {
+		c.sendError(id, errCodeControlFailed, err.Error(), err)
+		return
+	}
+
+	slog.Info("Control action", "room", c.roomID, "moderator", c.id, "action", control.Action, "peer", control.Peer, "track", control.TrackID)
+	_ = c.send(controlMessage(id, c.roomID, c.id, control))
+}
+
+// kick removes a member from the room of the moderator.
+func (h *wsHandler) kick(c *webRTCClientConn, peerID WebRTCClientID) error {
+	if peerID == c.id {
+		return fmt.Errorf("moderators cannot kick themselves")
+	}
+
+	member, ok := h.roomRegistry.Member(c.roomID, string(peerID))
+	if !ok {
+		return fmt.Errorf("peer %s is not in room %s", peerID, c.roomID)
+	}
+
+	h.evict(member.(*webRTCClientConn), controlMessage("", c.roomID, c.id, &WebRTCControl{
+		Action: controlKick,
+		Peer:   peerID,
+	}))
+
+	return nil
+}
+
+// endRoom evicts every member of the room, the moderator included. The
+// notice sent to the moderator carries the request ID.
+func (h *wsHandler) endRoom(c *webRTCClientConn, id string) {
+	slog.Info("Ending room", "room", c.roomID, "moderator", c.id)
+
+	control := &WebRTCControl{Action: controlEndRoom}
+	for _, m := range h.roomRegistry.Members(c.roomID) {
+		if member := m.(*webRTCClientConn); member != c {
+			h.evict(member, controlMessage("", c.roomID, c.id, control))
+		}
+	}
+	h.evict(c, controlMessage(id, c.roomID, c.id, control))
+}
+
+// evict sends the notice to the client and closes its SFU peer and its
+// socket. An evicted client leaves the room right away instead of being
+// held for resume.
+func (h *wsHandler) evict(target *webRTCClientConn, notice *WebRTCClientMessage) {
+	h.heldMx.Lock()
+	target.evicted.Store(true)
+	h.heldMx.Unlock()
+
+	_ = target.send(notice)
+	if peerLocal := target.peer(); peerLocal != nil {
+		_ = peerLocal.Close()
+	}
+	target.close()
+
+	// A client that is already disconnected is only held and has no
+	// connection left to tear it down.
+	h.expire(target)
+}
+
+// setTrackMuted stops or resumes forwarding a published track to every
+// subscriber in the room and tells the room about it. The state sticks to
+// the track across republishing. An empty streamID matches the stream the
+// owner publishes the track in.
+func (h *wsHandler) setTrackMuted(c *webRTCClientConn, peerID WebRTCClientID, streamID, trackID string, muted bool) error {
+	member, ok := h.roomRegistry.Member(c.roomID, string(peerID))
+	if !ok {
+		return fmt.Errorf("peer %s is not in room %s", peerID, c.roomID)
+	}
+	owner := member.(*webRTCClientConn)
+
+	owner.tracksMx.Lock()
+	meta, published := owner.tracks[trackID]
+	published = published && (streamID == "" || meta.StreamID == streamID)
+	if published {
+		streamID = meta.StreamID
+		if muted {
+			owner.mutedTracks[trackID] = struct{}{}
+		} else {
+			delete(owner.mutedTracks, trackID)
+		}
+	}
+	owner.tracksMx.Unlock()
+	if !published {
+		return fmt.Errorf("track %s is not published by %s", trackID, peerID)
+	}
+
+	h.muteDownTracks(c.roomID, owner.id, streamID, trackID, muted)
+
+	action := controlUnmute
+	if muted {
+		action = controlMute
+	}
+	h.broadcast(c.roomID, c.id, controlMessage("", c.roomID, c.id, &WebRTCControl{
+		Action:   action,
+		Peer:     owner.id,
+		StreamID: streamID,
+		TrackID:  trackID,
+	}))
+
+	return nil
+}
+
+// muteDownTracks mutes or unmutes the down tracks of a published track on
+// every subscriber in the room. Track IDs are chosen by the publisher and
+// only unique within a stream, so down tracks are matched on both.
+func (h *wsHandler) muteDownTracks(roomID string, owner WebRTCClientID, streamID, trackID string, muted bool) {
+	for _, m := range h.roomRegistry.Members(roomID) {
+		member := m.(*webRTCClientConn)
+		if member.id == owner {
+			continue
+		}
+		muteDownTrack(member, streamID, trackID, muted)
+	}
+}
+
+// applyMutes mutes the down tracks of a freshly joined client for every
+// track muted by a moderator.
+func (h *wsHandler) applyMutes(c *webRTCClientConn) {
+	for _, m := range h.roomRegistry.Members(c.roomID) {
+		member := m.(*webRTCClientConn)
+		if member.id == c.id {
+			continue
+		}
+
+		member.tracksMx.Lock()
+		muted := make([]WebRTCTrackMeta, 0, len(member.mutedTracks))
+		for trackID := range member.mutedTracks {
+			if meta, ok := member.tracks[trackID]; ok {
+				muted = append(muted, *meta)
+			}
+		}
+		member.tracksMx.Unlock()
+
+		for _, meta := range muted {
+			muteDownTrack(c, meta.StreamID, meta.TrackID, true)
+		}
+	}
+}
+
+func muteDownTrack(c *webRTCClientConn, streamID, trackID string, muted bool) {
+	peerLocal := c.peer()
+	if peerLocal == nil {
+		return
+	}
+	sub := peerLocal.Subscriber()
+	if sub == nil {
+		return
+	}
+
+	for _, dt := range sub.DownTracks() {
+		if dt.StreamID() == streamID && dt.ID() == trackID {
+			dt.Mute(muted)
+		}
+	}
+}
+
+func controlMessage(id, roomID string, from WebRTCClientID, control *WebRTCControl) *WebRTCClientMessage {
+	return &WebRTCClientMessage{
+		ID:     id,
+		RoomID: roomID,
+		SignalingMessage: &WebRTCSignalingMessage{
+			MessageType: webrtcControl,
+			Control:     control,
+		},
+		OriginPeerID: from,
+	}
+}
@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"github.com/ownerofglory/webrtc-sfu-demo/internal/core/domain"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// joinAs joins a room of an auth enabled server with a token for the role.
+func joinAs(t *testing.T, srv *httptest.Server, room, identity string, role domain.Role) *testClient {
+	t.Helper()
+
+	return join(t, srv, room, url.Values{accessTokenParam: {issueToken(t, room, identity, role)}})
+}
+
+func (c *testClient) control(id string, control *WebRTCControl) {
+	c.send(&WebRTCClientMessage{
+		ID:               id,
+		SignalingMessage: &WebRTCSignalingMessage{MessageType: webrtcControl, Control: control},
+	})
+}
+
+func TestKick(t *testing.T) {
+	srv, _ := newTestServer(t, true)
+	moderator := joinAs(t, srv, "room", "mod", domain.RoleModerator)
+	observer := joinAs(t, srv, "room", "observer", domain.RolePublisher)
+	target := joinAs(t, srv, "room", "target", domain.RolePublisher)
+	observer.expect(presencePeerJoined)
+
+	moderator.control("k1", &WebRTCControl{Action: controlKick, Peer: target.id})
+
+	notice := target.expect(webrtcControl)
+	if c := notice.SignalingMessage.Control; c.Action != controlKick || notice.OriginPeerID != moderator.id {
+		t.Errorf("target got %s from %s, want kick from %s", c.Action, notice.OriginPeerID, moderator.id)
+	}
+	target.expectClosed()
+
+	if m := observer.expectNext(presencePeerLeft); m.OriginPeerID != target.id {
+		t.Errorf("peer-left for %s, want %s", m.OriginPeerID, target.id)
+	}
+	if ack := moderator.expect(webrtcControl); ack.ID != "k1" {
+		t.Errorf("ack for %q, want k1", ack.ID)
+	}
+}
+
+func TestControlRejects(t *testing.T) {
+	tests := []struct {
+		name     string
+		role     domain.Role
+		control  *WebRTCControl
+		wantCode WebRTCErrorCode
+	}{
+		{
+			name:     "publisher",
+			role:     domain.RolePublisher,
+			control:  &WebRTCControl{Action: controlKick, Peer: "mod"},
+			wantCode: errCodeForbidden,
+		},
+		{
+			name:     "subscriber",
+			role:     domain.RoleSubscriber,
+			control:  &WebRTCControl{Action: controlEndRoom},
+			wantCode: errCodeForbidden,
+		},
+		{
+			name:     "kick self",
+			role:     domain.RoleModerator,
+			control:  &WebRTCControl{Action: controlKick, Peer: "sender"},
+			wantCode: errCodeControlFailed,
+		},
+		{
+			name:     "unknown peer",
+			role:     domain.RoleModerator,
+			control:  &WebRTCControl{Action: controlKick, Peer: "nobody"},
+			wantCode: errCodeControlFailed,
+		},
+		{
+			name:     "unknown action",
+			role:     domain.RoleModerator,
+			control:  &WebRTCControl{Action: "ban", Peer: "mod"},
+			wantCode: errCodeControlFailed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, _ := newTestServer(t, true)
+			mod := joinAs(t, srv, "room", "mod", domain.RoleModerator)
+			sender := joinAs(t, srv, "room", "sender", tt.role)
+			mod.expect(presencePeerJoined)
+
+			sender.control("c1", tt.control)
+			sender.expectError("c1", tt.wantCode)
+
+			// Nobody was evicted.
+			sender.chat("after", "still here")
+			mod.expectNext(webrtcChat)
+		})
+	}
+}
+
+func TestEndRoom(t *testing.T) {
+	srv, _ := newTestServer(t, true)
+	moderator := joinAs(t, srv, "room", "mod", domain.RoleModerator)
+	member := joinAs(t, srv, "room", "member", domain.RolePublisher)
+
+	moderator.control("e1", &WebRTCControl{Action: controlEndRoom})
+
+	if notice := member.expect(webrtcControl); notice.SignalingMessage.Control.Action != controlEndRoom {
+		t.Errorf("member got %s, want end-room", notice.SignalingMessage.Control.Action)
+	}
+	member.expectClosed()
+	if ack := moderator.expect(webrtcControl); ack.ID != "e1" {
+		t.Errorf("ack for %q, want e1", ack.ID)
+	}
+	moderator.expectClosed()
+}
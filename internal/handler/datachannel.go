@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"context"
+	"github.com/pion/ion-sfu/pkg/sfu"
+	"github.com/pion/webrtc/v3"
+	"log/slog"
+)
+
+// newRoomDatachannel returns a data channel that is negotiated with every
+// peer joining a room. Messages sent on it are relayed to all other peers
+// of the same room. A positive maxSize drops larger messages.
+func newRoomDatachannel(label string, maxSize int) *sfu.Datachannel {
+	dc := &sfu.Datachannel{Label: label}
+	if maxSize > 0 {
+		dc.Use(maxMessageSize(maxSize))
+	}
+	dc.OnMessage(func(ctx context.Context, args sfu.ProcessArgs) {
+		session := args.Peer.Session()
+		if session == nil {
+			return
+		}
+		session.FanOutMessage(args.Peer.ID(), label, args.Message)
+	})
+
+	return dc
+}
+
+// rejectClientDatachannel closes a data channel the client opened on its
+// publisher transport. ion-sfu would fan it out to the room without any
+// middleware, which bypasses the size limit and replaces the room channel
+// when the labels match, so only channels negotiated by the server are relayed.
+func rejectClientDatachannel(c *webRTCClientConn, dc *webrtc.DataChannel) {
+	if dc.Label() == sfu.APIChannelLabel {
+		return
+	}
+
+	slog.Warn("Closing client-created data channel", "client", c.id, "label", dc.Label())
+	_ = dc.Close()
+}
+
+func maxMessageSize(limit int) func(sfu.MessageProcessor) sfu.MessageProcessor {
+	return func(next sfu.MessageProcessor) sfu.MessageProcessor {
+		return sfu.ProcessFunc(func(ctx context.Context, args sfu.ProcessArgs) {
+			if size := len(args.Message.Data); size > limit {
+				slog.Warn("Dropping oversized data channel message", "peer", args.Peer.ID(), "size", size, "limit", limit)
+				return
+			}
+			next.Process(ctx, args)
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"fmt"
+	"time"
+)
+
+// webrtcDirect carries an application defined payload from one member of a
+// room to another. The server does not look into Data.
+const webrtcDirect WebRTCSignalingMessageType = "direct"
+
+// forward delivers a message addressed to another member of the sender's
+// room. Only chat and direct messages can be forwarded, and only their
+// payload is passed on, so that a client cannot make up server or
+// moderator events. The sender is stamped by the server; recipients
+// outside the sender's room are rejected.
+func (h *wsHandler) forward(c *webRTCClientConn, m *WebRTCClientMessage) {
+	var signal WebRTCSignalingMessage
+	switch m.SignalingMessage.MessageType {
+	case webrtcChat:
+		if !h.acceptChat(c, m.ID, m.SignalingMessage.Text) {
+			return
+		}
+		sentAt := time.Now().UTC()
+		signal = WebRTCSignalingMessage{
+			MessageType: webrtcChat,
+			Text:        m.SignalingMessage.Text,
+			SentAt:      &sentAt,
+		}
+	case webrtcDirect:
+		if len(m.SignalingMessage.Data) == 0 {
+			c.sendError(m.ID, errCodeInvalidMessage, "direct message without data",
+				fmt.Errorf("missing direct message data"))
+			return
+		}
+		signal = WebRTCSignalingMessage{
+			MessageType: webrtcDirect,
+			Data:        m.SignalingMessage.Data,
+		}
+	default:
+		c.sendError(m.ID, errCodeForwardFailed, "only chat and direct messages can be sent to a peer",
+			fmt.Errorf("%s message addressed to %s", m.SignalingMessage.MessageType, m.ReceiverPeerID))
+		return
+	}
+
+	member, ok := h.roomRegistry.Member(c.roomID, string(m.ReceiverPeerID))
+	if !ok {
+		c.sendError(m.ID, errCodeForwardFailed, "unable to deliver message",
+			fmt.Errorf("peer %s is not in room %s", m.ReceiverPeerID, c.roomID))
+		return
+	}
+
+	if err := member.(*webRTCClientConn).send(&WebRTCClientMessage{
+		ID:               m.ID,
+		RoomID:           c.roomID,
+		SignalingMessage: &signal,
+		ReceiverPeerID:   m.ReceiverPeerID,
+		OriginPeerID:     c.id,
+	}); err != nil {
+		c.sendError(m.ID, errCodeForwardFailed, "unable to deliver message", err)
+	}
+}
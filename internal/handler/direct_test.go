@@ -0,0 +1,121 @@
+package handler
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestForwardDelivers(t *testing.T) {
+	tests := []struct {
+		name   string
+		signal *WebRTCSignalingMessage
+	}{
+		{
+			name:   "chat",
+			signal: &WebRTCSignalingMessage{MessageType: webrtcChat, Text: "hi"},
+		},
+		{
+			name:   "direct",
+			signal: &WebRTCSignalingMessage{MessageType: webrtcDirect, Data: json.RawMessage(`{"x":1}`)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, _ := newTestServer(t, false)
+			receiver := join(t, srv, "room", nil)
+			sender := join(t, srv, "room", nil)
+			receiver.expect(presencePeerJoined)
+
+			sender.send(&WebRTCClientMessage{
+				ID:               "m1",
+				SignalingMessage: tt.signal,
+				ReceiverPeerID:   receiver.id,
+				// The server stamps the sender.
+				OriginPeerID: receiver.id,
+			})
+
+			m := receiver.expectNext(tt.signal.MessageType)
+			if m.OriginPeerID != sender.id || m.ReceiverPeerID != receiver.id {
+				t.Errorf("delivered from %s to %s, want from %s to %s", m.OriginPeerID, m.ReceiverPeerID, sender.id, receiver.id)
+			}
+			if m.SignalingMessage.Text != tt.signal.Text || string(m.SignalingMessage.Data) != string(tt.signal.Data) {
+				t.Errorf("delivered %+v, want the payload of %+v", m.SignalingMessage, tt.signal)
+			}
+		})
+	}
+}
+
+func TestForwardRejects(t *testing.T) {
+	tests := []struct {
+		name     string
+		signal   *WebRTCSignalingMessage
+		to       WebRTCClientID
+		wantCode WebRTCErrorCode
+	}{
+		{
+			name:     "control",
+			signal:   &WebRTCSignalingMessage{MessageType: webrtcControl, Control: &WebRTCControl{Action: controlKick}},
+			wantCode: errCodeForwardFailed,
+		},
+		{
+			name:     "presence",
+			signal:   &WebRTCSignalingMessage{MessageType: presencePeerLeft},
+			wantCode: errCodeForwardFailed,
+		},
+		{
+			name:     "error",
+			signal:   &WebRTCSignalingMessage{MessageType: webrtcError, Error: &WebRTCError{Code: errCodeJoinFailed}},
+			wantCode: errCodeForwardFailed,
+		},
+		{
+			name:     "empty chat",
+			signal:   &WebRTCSignalingMessage{MessageType: webrtcChat},
+			wantCode: errCodeChatRejected,
+		},
+		{
+			name:     "chat too long",
+			signal:   &WebRTCSignalingMessage{MessageType: webrtcChat, Text: strings.Repeat("a", 2001)},
+			wantCode: errCodeChatRejected,
+		},
+		{
+			name:     "direct without data",
+			signal:   &WebRTCSignalingMessage{MessageType: webrtcDirect},
+			wantCode: errCodeInvalidMessage,
+		},
+		{
+			name:     "unknown recipient",
+			signal:   &WebRTCSignalingMessage{MessageType: webrtcChat, Text: "hi"},
+			to:       "nobody",
+			wantCode: errCodeForwardFailed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, _ := newTestServer(t, false)
+			receiver := join(t, srv, "room", nil)
+			sender := join(t, srv, "room", nil)
+			receiver.expect(presencePeerJoined)
+
+			to := tt.to
+			if to == "" {
+				to = receiver.id
+			}
+			sender.send(&WebRTCClientMessage{ID: "m1", SignalingMessage: tt.signal, ReceiverPeerID: to})
+			sender.expectError("m1", tt.wantCode)
+
+			// Messages are handled in order, so nothing was delivered if the
+			// marker is the next message of the receiver.
+			sender.send(&WebRTCClientMessage{
+				ID:               "marker",
+				SignalingMessage: &WebRTCSignalingMessage{MessageType: webrtcChat, Text: "marker"},
+				ReceiverPeerID:   receiver.id,
+			})
+			if m := receiver.expectNext(webrtcChat); m.ID != "marker" {
+				t.Errorf("receiver got chat %q, want the marker", m.ID)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+)
+
+type (
+	WebRTCErrorCode string
+
+	// WebRTCError is sent to the client when the server rejects or fails to
+	// handle something. Code is machine readable, Message is meant for
+	// humans and CorrelationID matches the server log entry of the failure.
+	WebRTCError struct {
+		Code          WebRTCErrorCode `json:"code"`
+		Message       string          `json:"message,omitempty"`
+		CorrelationID string          `json:"correlationId,omitempty"`
+	}
+)
+
+const webrtcError WebRTCSignalingMessageType = "error"
+
+const (
+	errCodeInvalidMessage       WebRTCErrorCode = "invalid-message"
+	errCodeUnsupportedType      WebRTCErrorCode = "unsupported-type"
+	errCodeHandshakeRequired    WebRTCErrorCode = "handshake-required"
+	errCodeUnsupportedVersion   WebRTCErrorCode = "unsupported-version"
+	errCodeRoomFull             WebRTCErrorCode = "room-full"
+	errCodeServerFull           WebRTCErrorCode = "server-full"
+	errCodeNameTaken            WebRTCErrorCode = "name-taken"
+	errCodePublisherLimit       WebRTCErrorCode = "publisher-limit"
+	errCodeJoinFailed           WebRTCErrorCode = "join-failed"
+	errCodeResumeFailed         WebRTCErrorCode = "resume-failed"
+	errCodeICEConfigUnavailable WebRTCErrorCode = "ice-config-unavailable"
+	errCodeOfferFailed          WebRTCErrorCode = "offer-failed"
+	errCodeAnswerFailed         WebRTCErrorCode = "answer-failed"
+	errCodeCandidateFailed      WebRTCErrorCode = "candidate-failed"
+	errCodeLayerFailed          WebRTCErrorCode = "layer-failed"
+	errCodeICERestartFailed     WebRTCErrorCode = "ice-restart-failed"
+	errCodeForwardFailed        WebRTCErrorCode = "forward-failed"
+	errCodeChatRejected         WebRTCErrorCode = "chat-rejected"
+	errCodeForbidden            WebRTCErrorCode = "forbidden"
+	errCodeControlFailed        WebRTCErrorCode = "control-failed"
+	errCodeInLobby              WebRTCErrorCode = "in-lobby"
+)
+
+// sendError logs a failure and reports it to the client under a fresh
+// correlation ID. replyTo is the ID of the failed request, if any.
+func (c *webRTCClientConn) sendError(replyTo string, code WebRTCErrorCode, message string, cause error) {
+	correlationID := newMessageID()
+	slog.Warn("Signaling error", "client", c.id, "room", c.roomID, "code", code, "correlationId", correlationID, "err", cause)
+
+	err := c.send(&WebRTCClientMessage{
+		ID:     replyTo,
+		RoomID: c.roomID,
+		SignalingMessage: &WebRTCSignalingMessage{
+			MessageType: webrtcError,
+			Error: &WebRTCError{
+				Code:          code,
+				Message:       message,
+				CorrelationID: correlationID,
+			},
+		},
+	})
+	if err != nil {
+		slog.Warn("Error sending error message", "client", c.id, "code", code, "err", err)
+	}
+}
+
+// newMessageID returns a random ID for server initiated messages and error correlation.
+func newMessageID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ownerofglory/webrtc-sfu-demo/internal/core/domain"
+	"log/slog"
+	"net"
+	"time"
+)
+
+// protocolVersion is the signaling protocol version spoken by the server.
+const protocolVersion = 1
+
+const (
+	webrtcHello   WebRTCSignalingMessageType = "hello"
+	webrtcWelcome WebRTCSignalingMessageType = "welcome"
+)
+
+type (
+	WebRTCFeature string
+
+	// WebRTCHandshake is the payload of the hello sent by the client as its
+	// first message and of the welcome the server answers with. The welcome
+	// also tells the client its role in the room.
+	WebRTCHandshake struct {
+		Version    int             `json:"version"`
+		Features   []WebRTCFeature `json:"features,omitempty"`
+		AppVersion string          `json:"appVersion,omitempty"`
+		Role       domain.Role     `json:"role,omitempty"`
+	}
+)
+
+// Features a client may declare. The server never offers e2ee: it forwards
+// media as is but takes no part in key exchange.
+const (
+	featureTrickle     WebRTCFeature = "trickle"
+	featureSimulcast   WebRTCFeature = "simulcast"
+	featureDatachannel WebRTCFeature = "datachannel"
+	featureE2EE        WebRTCFeature = "e2ee"
+)
+
+// features returns the feature set the server supports for the client.
+// ion-sfu only sets up data channels for peers that may publish.
+func (h *wsHandler) features(c *webRTCClientConn) []WebRTCFeature {
+	features := []WebRTCFeature{featureTrickle, featureSimulcast}
+	if len(h.datachannels) > 0 && c.role.CanPublish() {
+		features = append(features, featureDatachannel)
+	}
+
+	return features
+}
+
+// handshake reads the hello of the client and checks its protocol version.
+// The hello has to arrive within the hello timeout, so that clients waiting
+// for the server to speak first are rejected quickly. Failures are reported
+// to the client; the caller only has to close the connection.
+func (h *wsHandler) handshake(c *webRTCClientConn) (*WebRTCClientMessage, error) {
+	_, payload, err := c.conn.ReadMessage()
+	if err != nil {
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			c.sendError("", errCodeHandshakeRequired, "the first message must be a hello", err)
+		}
+		return nil, fmt.Errorf("reading hello: %w", err)
+	}
+	_ = c.conn.SetReadDeadline(time.Now().Add(h.pongTimeout))
+
+	var m WebRTCClientMessage
+	if err := json.Unmarshal(payload, &m); err != nil {
+		c.sendError("", errCodeInvalidMessage, "message is not valid JSON", err)
+		return nil, err
+	}
+
+	if m.SignalingMessage == nil || m.SignalingMessage.MessageType != webrtcHello || m.SignalingMessage.Handshake == nil {
+		err := fmt.Errorf("expected hello as first message")
+		c.sendError(m.ID, errCodeHandshakeRequired, "the first message must be a hello", err)
+		return nil, err
+	}
+
+	hello := m.SignalingMessage.Handshake
+	if hello.Version != protocolVersion {
+		err := fmt.Errorf("unsupported protocol version %d", hello.Version)
+		c.sendError(m.ID, errCodeUnsupportedVersion, fmt.Sprintf("protocol version %d is not supported, the server speaks version %d", hello.Version, protocolVersion), err)
+		return nil, err
+	}
+
+	slog.Debug("Client hello", "version", hello.Version, "features", hello.Features)
+
+	return &m, nil
+}
+
+// welcome builds the reply to the hello of the client.
+func (h *wsHandler) welcome(c *webRTCClientConn, hello *WebRTCClientMessage) *WebRTCClientMessage {
+	return &WebRTCClientMessage{
+		ID:           hello.ID,
+		OriginPeerID: c.id,
+		RoomID:       c.roomID,
+		ResumeToken:  c.resumeToken,
+		SignalingMessage: &WebRTCSignalingMessage{
+			MessageType: webrtcWelcome,
+			Handshake: &WebRTCHandshake{
+				Version:    protocolVersion,
+				Features:   h.features(c),
+				AppVersion: AppVersion,
+				Role:       c.role,
+			},
+		},
+	}
+}
@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"fmt"
+	"github.com/pion/ion-sfu/pkg/sfu"
+)
+
+// WebRTCLayerRequest selects the simulcast layers a subscriber receives for
+// one track, identified by the stream and track ID announced in
+// track-published. Spatial layers are 0 (low), 1 (medium) and 2 (high). With Max
+// set the layers also become the upper bound the SFU may switch up to when
+// bandwidth allows.
+type WebRTCLayerRequest struct {
+	StreamID string `json:"streamId"`
+	TrackID  string `json:"trackId"`
+	Spatial  *int32 `json:"spatial,omitempty"`
+	Temporal *int32 `json:"temporal,omitempty"`
+	Max      bool   `json:"max,omitempty"`
+}
+
+const (
+	webrtcLayer WebRTCSignalingMessageType = "layer"
+
+	maxSpatialLayer  = 2
+	maxTemporalLayer = 2
+)
+
+// switchLayer applies a layer request to the subscriber's down track for the requested track.
+func switchLayer(peerLocal *sfu.PeerLocal, req *WebRTCLayerRequest) error {
+	if req == nil || req.StreamID == "" || req.TrackID == "" {
+		return fmt.Errorf("missing stream or track in layer request")
+	}
+
+	sub := peerLocal.Subscriber()
+	if sub == nil {
+		return sfu.ErrNoTransportEstablished
+	}
+
+	var downTrack *sfu.DownTrack
+	for _, dt := range sub.DownTracks() {
+		if dt.StreamID() == req.StreamID && dt.ID() == req.TrackID {
+			downTrack = dt
+			break
+		}
+	}
+	if downTrack == nil {
+		return fmt.Errorf("track %s of stream %s not subscribed", req.TrackID, req.StreamID)
+	}
+
+	if req.Spatial != nil {
+		if *req.Spatial < 0 || *req.Spatial > maxSpatialLayer {
+			return fmt.Errorf("invalid spatial layer %d", *req.Spatial)
+		}
+		if err := downTrack.SwitchSpatialLayer(*req.Spatial, req.Max); err != nil {
+			return err
+		}
+	}
+
+	if req.Temporal != nil {
+		if *req.Temporal < 0 || *req.Temporal > maxTemporalLayer {
+			return fmt.Errorf("invalid temporal layer %d", *req.Temporal)
+		}
+		downTrack.SwitchTemporalLayer(*req.Temporal, req.Max)
+	}
+
+	return nil
+}
@@ -0,0 +1,185 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+)
+
+const (
+	lobbyWaiting        WebRTCSignalingMessageType = "lobby"
+	lobbyKnock          WebRTCSignalingMessageType = "knock"
+	lobbyKnockCancelled WebRTCSignalingMessageType = "knock-cancelled"
+)
+
+// knock parks the client in the lobby if the room is locked. Moderators
+// always get in. It reports whether the client has to wait for admission.
+// A waiting client has a nickname but is not a member of the room and has
+// no SFU peer.
+func (h *wsHandler) knock(c *webRTCClientConn, roomID string, hello *WebRTCClientMessage) (bool, error) {
+	if c.role.CanModerate() {
+		return false, nil
+	}
+
+	h.lobbyMx.Lock()
+	if _, locked := h.lockedRooms[roomID]; !locked {
+		h.lobbyMx.Unlock()
+		return false, nil
+	}
+	if err := h.assignNickname(c); err != nil {
+		h.lobbyMx.Unlock()
+		return false, err
+	}
+	c.roomID = roomID
+	c.waiting.Store(true)
+	if h.lobby[roomID] == nil {
+		h.lobby[roomID] = make(map[WebRTCClientID]*webRTCClientConn)
+	}
+	h.lobby[roomID][c.id] = c
+	h.lobbyMx.Unlock()
+
+	slog.Debug("Client waiting in lobby", "room", roomID, "client", c.id)
+
+	if err := c.send(&WebRTCClientMessage{
+		ID:           hello.ID,
+		RoomID:       roomID,
+		OriginPeerID: c.id,
+		SignalingMessage: &WebRTCSignalingMessage{
+			MessageType: lobbyWaiting,
+		},
+	}); err != nil {
+		slog.Error("Error sending lobby notice", "client", c.id, "err", err)
+	}
+	h.notifyModerators(roomID, lobbyMessage(roomID, c.id, lobbyKnock))
+
+	return true, nil
+}
+
+// leaveLobby drops a client that disconnected while waiting and frees its nickname.
+func (h *wsHandler) leaveLobby(c *webRTCClientConn) {
+	h.lobbyMx.Lock()
+	waiting := h.lobby[c.roomID][c.id] == c
+	if waiting {
+		delete(h.lobby[c.roomID], c.id)
+	}
+	h.lobbyMx.Unlock()
+
+	h.nicknameGenerator.Release(string(c.id))
+	if waiting {
+		h.notifyModerators(c.roomID, lobbyMessage(c.roomID, c.id, lobbyKnockCancelled))
+	}
+}
+
+// admit lets a waiting client into the room.
+func (h *wsHandler) admit(roomID string, peerID WebRTCClientID) error {
+	h.lobbyMx.Lock()
+	defer h.lobbyMx.Unlock()
+
+	waiting, ok := h.lobby[roomID][peerID]
+	if !ok {
+		return fmt.Errorf("peer %s is not waiting to join room %s", peerID, roomID)
+	}
+	delete(h.lobby[roomID], peerID)
+	close(waiting.admitted)
+
+	return nil
+}
+
+// deny turns a waiting client away. It is taken out of the lobby right
+// away, so that no other moderator can admit it before its connection is
+// closed.
+func (h *wsHandler) deny(c *webRTCClientConn, peerID WebRTCClientID) error {
+	h.lobbyMx.Lock()
+	waiting, ok := h.lobby[c.roomID][peerID]
+	if ok {
+		delete(h.lobby[c.roomID], peerID)
+	}
+	h.lobbyMx.Unlock()
+	if !ok {
+		return fmt.Errorf("peer %s is not waiting to join room %s", peerID, c.roomID)
+	}
+
+	_ = waiting.send(controlMessage("", c.roomID, c.id, &WebRTCControl{
+		Action: controlDeny,
+		Peer:   peerID,
+	}))
+	waiting.close()
+	h.notifyModerators(c.roomID, lobbyMessage(c.roomID, peerID, lobbyKnockCancelled))
+
+	return nil
+}
+
+// setLocked locks or unlocks the room of the moderator and tells the room
+// about it. Unlocking admits everybody still waiting.
+func (h *wsHandler) setLocked(c *webRTCClientConn, locked bool) {
+	h.lobbyMx.Lock()
+	if locked {
+		h.lockedRooms[c.roomID] = struct{}{}
+	} else {
+		delete(h.lockedRooms, c.roomID)
+		for id, waiting := range h.lobby[c.roomID] {
+			delete(h.lobby[c.roomID], id)
+			close(waiting.admitted)
+		}
+	}
+	h.lobbyMx.Unlock()
+
+	action := controlUnlock
+	if locked {
+		action = controlLock
+	}
+	h.broadcast(c.roomID, c.id, controlMessage("", c.roomID, c.id, &WebRTCControl{
+		Action: action,
+	}))
+}
+
+// closeLobby unlocks a room that is gone and turns away everybody still waiting.
+func (h *wsHandler) closeLobby(roomID string) {
+	h.lobbyMx.Lock()
+	delete(h.lockedRooms, roomID)
+	waiting := h.lobby[roomID]
+	delete(h.lobby, roomID)
+	h.lobbyMx.Unlock()
+
+	for _, c := range waiting {
+		c.sendError("", errCodeJoinFailed, "the room has closed", fmt.Errorf("room %s closed", roomID))
+		c.close()
+	}
+}
+
+// sendKnocks tells a moderator about every client waiting in its room.
+func (h *wsHandler) sendKnocks(c *webRTCClientConn) {
+	h.lobbyMx.Lock()
+	waiting := make([]WebRTCClientID, 0, len(h.lobby[c.roomID]))
+	for id := range h.lobby[c.roomID] {
+		waiting = append(waiting, id)
+	}
+	h.lobbyMx.Unlock()
+
+	for _, id := range waiting {
+		if err := c.send(lobbyMessage(c.roomID, id, lobbyKnock)); err != nil {
+			slog.Error("Error sending knock", "client", c.id, "err", err)
+			return
+		}
+	}
+}
+
+func (h *wsHandler) notifyModerators(roomID string, msg *WebRTCClientMessage) {
+	for _, m := range h.roomRegistry.Members(roomID) {
+		if member := m.(*webRTCClientConn); member.role.CanModerate() {
+			if err := member.send(msg); err != nil && !errors.Is(err, errConnClosed) {
+				slog.Warn("Error notifying moderator", "client", member.id, "err", err)
+			}
+		}
+	}
+}
+
+func lobbyMessage(roomID string, from WebRTCClientID, t WebRTCSignalingMessageType) *WebRTCClientMessage {
+	return &WebRTCClientMessage{
+		RoomID:       roomID,
+		OriginPeerID: from,
+		SignalingMessage: &WebRTCSignalingMessage{
+			MessageType: t,
+		},
+	}
+}
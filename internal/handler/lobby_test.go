@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"github.com/ownerofglory/webrtc-sfu-demo/internal/core/domain"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// lockedRoom returns a server with a moderator in a locked room.
+func lockedRoom(t *testing.T) (*httptest.Server, *testClient) {
+	t.Helper()
+
+	srv, _ := newTestServer(t, true)
+	moderator := joinAs(t, srv, "room", "mod", domain.RoleModerator)
+	moderator.control("lock", &WebRTCControl{Action: controlLock})
+	moderator.expect(webrtcControl)
+
+	return srv, moderator
+}
+
+// knock connects a publisher to a locked room and waits until it is in the lobby.
+func knock(t *testing.T, srv *httptest.Server, moderator *testClient, identity string) *testClient {
+	t.Helper()
+
+	c := dial(t, srv, "room", url.Values{accessTokenParam: {issueToken(t, "room", identity, domain.RolePublisher)}})
+	c.hello()
+	c.id = c.expectNext(lobbyWaiting).OriginPeerID
+	if m := moderator.expectNext(lobbyKnock); m.OriginPeerID != c.id {
+		t.Fatalf("knock from %s, want %s", m.OriginPeerID, c.id)
+	}
+
+	return c
+}
+
+func TestLobbyAdmit(t *testing.T) {
+	srv, moderator := lockedRoom(t)
+	waiting := knock(t, srv, moderator, "guest")
+
+	waiting.chat("early", "let me in")
+	waiting.expectError("early", errCodeInLobby)
+
+	moderator.control("a1", &WebRTCControl{Action: controlAdmit, Peer: waiting.id})
+	if welcome := waiting.expect(webrtcWelcome); welcome.OriginPeerID != waiting.id {
+		t.Errorf("welcomed as %s, want %s", welcome.OriginPeerID, waiting.id)
+	}
+	if m := moderator.expect(presencePeerJoined); m.OriginPeerID != waiting.id {
+		t.Errorf("peer-joined for %s, want %s", m.OriginPeerID, waiting.id)
+	}
+}
+
+func TestLobbyDeny(t *testing.T) {
+	srv, moderator := lockedRoom(t)
+	waiting := knock(t, srv, moderator, "guest")
+
+	moderator.control("d1", &WebRTCControl{Action: controlDeny, Peer: waiting.id})
+	if m := waiting.expectNext(webrtcControl); m.SignalingMessage.Control.Action != controlDeny {
+		t.Errorf("waiting client got %s, want deny", m.SignalingMessage.Control.Action)
+	}
+	waiting.expectClosed()
+	if m := moderator.expectNext(lobbyKnockCancelled); m.OriginPeerID != waiting.id {
+		t.Errorf("knock-cancelled for %s, want %s", m.OriginPeerID, waiting.id)
+	}
+	moderator.expectNext(webrtcControl)
+
+	// A denied client cannot be admitted anymore.
+	moderator.control("a1", &WebRTCControl{Action: controlAdmit, Peer: waiting.id})
+	moderator.expectError("a1", errCodeControlFailed)
+}
+
+func TestLobbyUnlockAdmitsEverybody(t *testing.T) {
+	srv, moderator := lockedRoom(t)
+	first := knock(t, srv, moderator, "first")
+	second := knock(t, srv, moderator, "second")
+
+	moderator.control("u1", &WebRTCControl{Action: controlUnlock})
+	first.expect(webrtcWelcome)
+	second.expect(webrtcWelcome)
+}
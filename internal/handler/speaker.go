@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"github.com/pion/ion-sfu/pkg/sfu"
+	"slices"
+	"time"
+)
+
+const (
+	activeSpeaker WebRTCSignalingMessageType = "active-speaker"
+
+	defaultAudioLevelInterval = 1000
+)
+
+// observedSession hands out an audio observer owned by the handler instead
+// of the session's own one. ion-sfu polls its internal observer only to
+// feed the "ion-sfu" data channel, and polling resets the observer, so the
+// handler needs a separate one to drive active-speaker messages.
+type observedSession struct {
+	sfu.Session
+	audioObserver *sfu.AudioObserver
+}
+
+func newObservedSession(session sfu.Session, router sfu.RouterConfig) *observedSession {
+	return &observedSession{
+		Session:       session,
+		audioObserver: sfu.NewAudioObserver(router.AudioLevelThreshold, audioLevelInterval(router), router.AudioLevelFilter),
+	}
+}
+
+func (s *observedSession) AudioObserver() *sfu.AudioObserver {
+	return s.audioObserver
+}
+
+func audioLevelInterval(router sfu.RouterConfig) int {
+	if router.AudioLevelInterval <= 0 {
+		return defaultAudioLevelInterval
+	}
+	return router.AudioLevelInterval
+}
+
+// observeSpeakers periodically computes the loudest audio streams of the
+// room and, whenever the speakers change, sends the owning peers, loudest
+// first, to every member. An empty list means nobody speaks. It runs until
+// stop is closed.
+func (h *wsHandler) observeSpeakers(roomID string, session *observedSession, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// The observer reports changes anywhere in its ranking, so changes below
+	// the speakers that are sent are filtered out here.
+	last := []WebRTCClientID{}
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			streamIDs := session.audioObserver.Calc()
+			if streamIDs == nil {
+				continue
+			}
+
+			peers := h.speakers(roomID, streamIDs)
+			if slices.Equal(peers, last) {
+				continue
+			}
+			last = peers
+
+			h.broadcast(roomID, "", &WebRTCClientMessage{
+				RoomID: roomID,
+				SignalingMessage: &WebRTCSignalingMessage{
+					MessageType: activeSpeaker,
+					Peers:       peers,
+				},
+			})
+		}
+	}
+}
+
+// speakers maps audio stream IDs to the peers publishing them, keeping the
+// order and at most speakerCount peers.
+func (h *wsHandler) speakers(roomID string, streamIDs []string) []WebRTCClientID {
+	owners := make(map[string]WebRTCClientID)
+	for _, m := range h.roomRegistry.Members(roomID) {
+		member := m.(*webRTCClientConn)
+		member.tracksMx.Lock()
+		for _, meta := range member.tracks {
+			owners[meta.StreamID] = member.id
+		}
+		member.tracksMx.Unlock()
+	}
+
+	peers := make([]WebRTCClientID, 0, h.speakerCount)
+	for _, id := range streamIDs {
+		if len(peers) == h.speakerCount {
+			break
+		}
+		if owner, ok := owners[id]; ok {
+			peers = append(peers, owner)
+		}
+	}
+
+	return peers
+}
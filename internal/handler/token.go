@@ -0,0 +1,108 @@
+package handler
+
+import (
+	"encoding/json"
+	"github.com/ownerofglory/webrtc-sfu-demo/config"
+	"github.com/ownerofglory/webrtc-sfu-demo/internal/core/domain"
+	"github.com/ownerofglory/webrtc-sfu-demo/internal/core/ports"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+const PostAccessTokenPath = basePath + "/tokens"
+
+const maxAccessTokenRequestSize = 1 << 16
+
+type (
+	// AccessTokenRequest asks for a token granting Identity access to Room.
+	// Name defaults to Identity, Role to publisher and TTL, in seconds, to
+	// the configured token TTL.
+	AccessTokenRequest struct {
+		Room     string      `json:"room"`
+		Identity string      `json:"identity"`
+		Name     string      `json:"name,omitempty"`
+		Role     domain.Role `json:"role,omitempty"`
+		TTL      int         `json:"ttl,omitempty"`
+	}
+
+	AccessTokenResponse struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expiresAt"`
+	}
+)
+
+type accessTokenHandler struct {
+	issuer     ports.TokenIssuer
+	defaultTTL time.Duration
+	maxTTL     time.Duration
+}
+
+func NewAccessTokenHandler(cfg *config.WebRTCSFUAppConfig, issuer ports.TokenIssuer) *accessTokenHandler {
+	return &accessTokenHandler{
+		issuer:     issuer,
+		defaultTTL: cfg.AuthTokenTTL,
+		maxTTL:     cfg.AuthTokenMaxTTL,
+	}
+}
+
+func (h *accessTokenHandler) HandlePostAccessToken(rw http.ResponseWriter, r *http.Request) {
+	var req AccessTokenRequest
+	if err := json.NewDecoder(http.MaxBytesReader(rw, r.Body, maxAccessTokenRequestSize)).Decode(&req); err != nil {
+		http.Error(rw, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Room == "" || req.Identity == "" {
+		http.Error(rw, "room and identity are required", http.StatusBadRequest)
+		return
+	}
+	if req.Name == "" {
+		req.Name = req.Identity
+	}
+	if req.Role == "" {
+		req.Role = domain.RolePublisher
+	}
+	if !req.Role.Valid() {
+		http.Error(rw, "unknown role", http.StatusBadRequest)
+		return
+	}
+
+	ttl := h.defaultTTL
+	if req.TTL != 0 {
+		ttl = time.Duration(req.TTL) * time.Second
+	}
+	if ttl <= 0 || (h.maxTTL > 0 && ttl > h.maxTTL) {
+		http.Error(rw, "ttl out of range", http.StatusBadRequest)
+		return
+	}
+
+	token, expiresAt, err := h.issuer.Issue(domain.AccessClaims{
+		Subject: req.Identity,
+		Room:    req.Room,
+		Name:    req.Name,
+		Role:    req.Role,
+	}, ttl)
+	if err != nil {
+		slog.Error("Error issuing access token", "error", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	respPayload, err := json.Marshal(AccessTokenResponse{
+		Token:     token,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		slog.Error("Error marshalling response body", "error", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	slog.Debug("Issued access token", "room", req.Room, "identity", req.Identity, "role", req.Role, "ttl", ttl)
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Header().Set("Cache-Control", "no-store")
+	rw.WriteHeader(http.StatusCreated)
+	rw.Write(respPayload)
+}
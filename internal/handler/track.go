@@ -0,0 +1,142 @@
+package handler
+
+import (
+	"github.com/pion/ion-sfu/pkg/sfu"
+	"github.com/pion/webrtc/v3"
+	"log/slog"
+	"strings"
+)
+
+type WebRTCTrackMeta struct {
+	StreamID string `json:"streamId"`
+	TrackID  string `json:"trackId"`
+	Kind     string `json:"kind"`
+	Muted    bool   `json:"muted,omitempty"`
+}
+
+const (
+	trackPublished   WebRTCSignalingMessageType = "track-published"
+	trackUnpublished WebRTCSignalingMessageType = "track-unpublished"
+)
+
+// addTrack records a track published by the client and announces it to the room.
+func (h *wsHandler) addTrack(roomID string, c *webRTCClientConn, t sfu.PublisherTrack) {
+	meta := &WebRTCTrackMeta{
+		StreamID: t.Track.StreamID(),
+		TrackID:  t.Track.ID(),
+		Kind:     t.Track.Kind().String(),
+	}
+
+	c.tracksMx.Lock()
+	_, meta.Muted = c.mutedTracks[meta.TrackID]
+	c.tracks[meta.TrackID] = meta
+	c.tracksMx.Unlock()
+
+	if meta.Muted {
+		h.muteDownTracks(roomID, c.id, meta.StreamID, meta.TrackID, true)
+	}
+
+	slog.Debug("Track published", "room", roomID, "client", c.id, "stream", meta.StreamID, "track", meta.TrackID)
+	h.broadcast(roomID, c.id, trackMessage(roomID, c.id, trackPublished, meta))
+}
+
+// syncTracks removes and announces every recorded track that is no longer
+// among the active tracks of the latest publisher offer.
+func (h *wsHandler) syncTracks(roomID string, c *webRTCClientConn, active map[string]struct{}) {
+	var removed []*WebRTCTrackMeta
+	c.tracksMx.Lock()
+	for id, meta := range c.tracks {
+		if _, ok := active[id]; !ok {
+			delete(c.tracks, id)
+			removed = append(removed, meta)
+		}
+	}
+	c.tracksMx.Unlock()
+
+	for _, meta := range removed {
+		slog.Debug("Track unpublished", "room", roomID, "client", c.id, "stream", meta.StreamID, "track", meta.TrackID)
+		h.broadcast(roomID, c.id, trackMessage(roomID, c.id, trackUnpublished, meta))
+	}
+}
+
+// clearTracks announces every remaining track of the client as unpublished.
+func (h *wsHandler) clearTracks(roomID string, c *webRTCClientConn) {
+	c.tracksMx.Lock()
+	removed := make([]*WebRTCTrackMeta, 0, len(c.tracks))
+	for id, meta := range c.tracks {
+		delete(c.tracks, id)
+		removed = append(removed, meta)
+	}
+	c.tracksMx.Unlock()
+
+	for _, meta := range removed {
+		h.broadcast(roomID, c.id, trackMessage(roomID, c.id, trackUnpublished, meta))
+	}
+}
+
+// sendTracks sends the metadata of all tracks currently published in the room to the client.
+func (h *wsHandler) sendTracks(roomID string, c *webRTCClientConn) {
+	for _, m := range h.roomRegistry.Members(roomID) {
+		member := m.(*webRTCClientConn)
+		if member.id == c.id {
+			continue
+		}
+
+		member.tracksMx.Lock()
+		metas := make([]*WebRTCTrackMeta, 0, len(member.tracks))
+		for id, meta := range member.tracks {
+			current := *meta
+			_, current.Muted = member.mutedTracks[id]
+			metas = append(metas, &current)
+		}
+		member.tracksMx.Unlock()
+
+		for _, meta := range metas {
+			if err := c.send(trackMessage(roomID, member.id, trackPublished, meta)); err != nil {
+				slog.Error("Error sending track metadata", "client", c.id, "err", err)
+			}
+		}
+	}
+}
+
+func trackMessage(roomID string, owner WebRTCClientID, t WebRTCSignalingMessageType, meta *WebRTCTrackMeta) *WebRTCClientMessage {
+	return &WebRTCClientMessage{
+		RoomID:       roomID,
+		OriginPeerID: owner,
+		SignalingMessage: &WebRTCSignalingMessage{
+			MessageType: t,
+			Track:       meta,
+		},
+	}
+}
+
+// sentTrackIDs returns the IDs of all tracks the remote side sends according to the offer.
+func sentTrackIDs(offer webrtc.SessionDescription) (map[string]struct{}, bool) {
+	parsed, err := offer.Unmarshal()
+	if err != nil {
+		slog.Warn("Unable to parse offer", "err", err)
+		return nil, false
+	}
+
+	ids := make(map[string]struct{})
+	for _, md := range parsed.MediaDescriptions {
+		if md.MediaName.Port.Value == 0 {
+			continue
+		}
+		_, sendrecv := md.Attribute(webrtc.RTPTransceiverDirectionSendrecv.String())
+		_, sendonly := md.Attribute(webrtc.RTPTransceiverDirectionSendonly.String())
+		if !sendrecv && !sendonly {
+			continue
+		}
+
+		msid, ok := md.Attribute("msid")
+		if !ok {
+			continue
+		}
+		if parts := strings.Fields(msid); len(parts) == 2 {
+			ids[parts[1]] = struct{}{}
+		}
+	}
+
+	return ids, true
+}
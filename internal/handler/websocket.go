@@ -3,6 +3,8 @@ package handler
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/gorilla/websocket"
 	"github.com/ownerofglory/webrtc-sfu-demo/config"
 	"github.com/ownerofglory/webrtc-sfu-demo/internal/core/domain"
@@ -11,6 +13,7 @@ import (
 	"github.com/pion/webrtc/v3"
 	"log/slog"
 	"net/http"
+	"slices"
 	"sync"
 	"time"
 )
@@ -21,16 +24,45 @@ const WSAppPath = basePathWS + "/app"
 type (
 	wsHandler struct {
 		upgrader          *websocket.Upgrader
+		sfuConfig         sfu.Config
 		sfuHandler        *sfu.SFU
 		configFetcher     ports.RTCConfigFetcher
 		nicknameGenerator ports.NicknameGenerator
 		roomNameGenerator ports.RoomNameGenerator
+		roomRegistry      ports.RoomRegistry
+		pingInterval      time.Duration
+		pongTimeout       time.Duration
+		writeTimeout      time.Duration
+		helloTimeout      time.Duration
+		writeQueueSize    int
+		dropSlowClients   bool
+		resumeTokens      ports.ResumeTokenService
+		resumeGrace       time.Duration
+		heldMx            sync.Mutex
+		held              map[WebRTCClientID]*heldClient
+		speakerCount      int
+		datachannels      []*sfu.Datachannel
+		chatHistory       ports.ChatHistory
+		chatMaxLength     int
+		tokenVerifier     ports.TokenVerifier
+		lobbyMx           sync.Mutex
+		lockedRooms       map[string]struct{}
+		lobby             map[string]map[WebRTCClientID]*webRTCClientConn
+	}
+
+	// heldClient is a disconnected client whose nickname and room slot are
+	// kept until the grace period expires or the client resumes.
+	heldClient struct {
+		conn  *webRTCClientConn
+		token string
+		timer *time.Timer
 	}
 
 	WebRTCClientID string
 
 	WebRTCSignalingMessageType string
 	WebrtcSignalingMessageSDP  string
+	WebRTCTransportTarget      string
 
 	WebRTCSignalingMessage struct {
 		MessageType   WebRTCSignalingMessageType `json:"type,omitempty"`
@@ -38,76 +70,96 @@ type (
 		Candidate     string                     `json:"candidate,omitempty"`
 		SDPMid        string                     `json:"sdpMid,omitempty"`
 		SDPMLineIndex *uint16                    `json:"sdpMLineIndex,omitempty"`
+		UsernameFrag  string                     `json:"usernameFragment,omitempty"`
+		Target        WebRTCTransportTarget      `json:"target,omitempty"`
+		Peers         []WebRTCClientID           `json:"peers,omitzero"`
+		Track         *WebRTCTrackMeta           `json:"track,omitempty"`
+		Layer         *WebRTCLayerRequest        `json:"layer,omitempty"`
+		Text          string                     `json:"text,omitempty"`
+		SentAt        *time.Time                 `json:"sentAt,omitempty"`
+		Error         *WebRTCError               `json:"error,omitempty"`
+		Handshake     *WebRTCHandshake           `json:"handshake,omitempty"`
+		Control       *WebRTCControl             `json:"control,omitempty"`
+		Data          json.RawMessage            `json:"data,omitempty"`
 	}
 
+	// WebRTCClientMessage is the signaling envelope. ID is optional on
+	// client messages and echoed on the replies to them, so a client can
+	// match an answer, error or ack to its request. Offers initiated by the
+	// server carry an ID generated by the server.
 	WebRTCClientMessage struct {
+		ID               string                  `json:"id,omitempty"`
 		RoomID           string                  `json:"room,omitempty"`
 		SignalingMessage *WebRTCSignalingMessage `json:"signal"`
 		ReceiverPeerID   WebRTCClientID          `json:"to"`
 		OriginPeerID     WebRTCClientID          `json:"from"`
+		ResumeToken      string                  `json:"resumeToken,omitempty"`
 	}
-
-	webRTCClientConn struct {
-		conn              *websocket.Conn
-		id                WebRTCClientID
-		connCloseOnce     sync.Once
-		sfuPeer           *sfu.PeerLocal
-		readCh            chan *WebRTCClientMessage
-		writeCh           chan *WebRTCClientMessage
-		nicknameGenerator ports.NicknameGenerator
-	}
-
-	webRTCRoom struct {
-		id      string
-		members map[WebRTCClientID]*webRTCClientConn
-		session sfu.Session
-		cfg     *sfu.WebRTCTransportConfig
-	}
-
-	webRTCRoomMap map[string]*webRTCRoom
 )
 
 const (
 	webrtcOffer     WebRTCSignalingMessageType = "offer"
 	webrtcAnswer    WebRTCSignalingMessageType = "answer"
 	webrtcCandidate WebRTCSignalingMessageType = "candidate"
-)
 
-var (
-	rooms   webRTCRoomMap = make(map[string]*webRTCRoom)
-	roomsMx sync.RWMutex
+	webrtcICERestart WebRTCSignalingMessageType = "ice-restart"
+
+	presenceRoster     WebRTCSignalingMessageType = "roster"
+	presencePeerJoined WebRTCSignalingMessageType = "peer-joined"
+	presencePeerLeft   WebRTCSignalingMessageType = "peer-left"
 )
 
-var (
-	webRTCConnections = make(map[WebRTCClientID]*webRTCClientConn)
-	connMx            sync.RWMutex
+// Transport targets follow ion-sfu's dual transport model: clients publish
+// on the publisher transport and receive on the subscriber transport.
+const (
+	targetPublisher  WebRTCTransportTarget = "publisher"
+	targetSubscriber WebRTCTransportTarget = "subscriber"
 )
 
-func (r webRTCRoomMap) GetSession(sid string) (sfu.Session, sfu.WebRTCTransportConfig) {
-	roomsMx.RLock()
-	room, ok := r[sid]
-	roomsMx.RUnlock()
-	if !ok {
-		slog.Warn("room not found")
-		return nil, sfu.WebRTCTransportConfig{}
-	}
-
-	return room.session, *room.cfg
-}
+const resumeTokenParam = "resume"
 
 func NewWSHandler(conf *config.WebRTCSFUAppConfig,
+	sfuConfig sfu.Config,
 	sfuHandler *sfu.SFU,
 	configFetcher ports.RTCConfigFetcher,
 	nicknameGenerator ports.NicknameGenerator,
-	roomNameGenerator ports.RoomNameGenerator) *wsHandler {
+	roomNameGenerator ports.RoomNameGenerator,
+	roomRegistry ports.RoomRegistry,
+	resumeTokens ports.ResumeTokenService,
+	chatHistory ports.ChatHistory,
+	tokenVerifier ports.TokenVerifier) *wsHandler {
+	var datachannels []*sfu.Datachannel
+	if conf.DataChannelLabel != "" {
+		datachannels = append(datachannels, newRoomDatachannel(conf.DataChannelLabel, conf.DataChannelMaxMessageSize))
+	}
+
 	return &wsHandler{
 		nicknameGenerator: nicknameGenerator,
 		roomNameGenerator: roomNameGenerator,
+		roomRegistry:      roomRegistry,
+		pingInterval:      conf.WSPingInterval,
+		pongTimeout:       conf.WSPongTimeout,
+		writeTimeout:      conf.WSWriteTimeout,
+		helloTimeout:      conf.WSHelloTimeout,
+		writeQueueSize:    conf.WSWriteQueueSize,
+		dropSlowClients:   conf.WSSlowClientPolicy == config.SlowClientPolicyDrop,
+		resumeTokens:      resumeTokens,
+		resumeGrace:       conf.ResumeGracePeriod,
+		held:              make(map[WebRTCClientID]*heldClient),
+		lockedRooms:       make(map[string]struct{}),
+		lobby:             make(map[string]map[WebRTCClientID]*webRTCClientConn),
+		speakerCount:      conf.ActiveSpeakerCount,
+		datachannels:      datachannels,
+		chatHistory:       chatHistory,
+		chatMaxLength:     conf.ChatMaxLength,
+		tokenVerifier:     tokenVerifier,
 		configFetcher:     configFetcher,
+		sfuConfig:         sfuConfig,
 		sfuHandler:        sfuHandler,
 		upgrader: &websocket.Upgrader{
 			ReadBufferSize:  1024,
 			WriteBufferSize: 1024,
+			Subprotocols:    []string{wsSubprotocol},
 			CheckOrigin: func(r *http.Request) bool {
 				origin := r.Header.Get("Origin")
 				if origin == "" {
@@ -126,187 +178,828 @@ func NewWSHandler(conf *config.WebRTCSFUAppConfig,
 	}
 }
 
-func (h *wsHandler) HandleWS(rw http.ResponseWriter, req *http.Request) {
-	ctx, cancel := context.WithCancel(req.Context())
-	conn, err := h.upgrader.Upgrade(rw, req, nil)
-	if err != nil {
-		slog.Error("Error when upgrading to websocket", "err", err.Error())
-		return
+// roomFactory returns a factory building the SFU session for a room that is
+// not known to the registry yet. A failed ICE config fetch does not prevent
+// the room from being created, but the joining client is told about it.
+func (h *wsHandler) roomFactory(c *webRTCClientConn) ports.RoomFactory {
+	return func(roomID string) (*domain.Room, error) {
+		conf, err := h.configFetcher.FetchConfig(1 * time.Hour)
+		if err != nil {
+			c.sendError("", errCodeICEConfigUnavailable, "TURN servers unavailable, media may not connect", err)
+			conf = domain.WebRTCConfig{}
+		}
+
+		return h.newRoom(roomID, conf), nil
 	}
-	defer conn.Close()
+}
 
-	clientNickname := h.nicknameGenerator.Generate()
-	clientID := WebRTCClientID(clientNickname)
-	clientConn := &webRTCClientConn{
-		conn:              conn,
-		id:                clientID,
-		readCh:            make(chan *WebRTCClientMessage),
-		writeCh:           make(chan *WebRTCClientMessage),
-		nicknameGenerator: h.nicknameGenerator,
+// newRoom builds the SFU session for a room using the given ICE servers in
+// addition to the configured ones.
+func (h *wsHandler) newRoom(roomID string, conf domain.WebRTCConfig) *domain.Room {
+	sfuConfig := h.sfuConfig
+	sfuConfig.WebRTC.ICEServers = slices.Clone(h.sfuConfig.WebRTC.ICEServers)
+	for _, ice := range conf.ICEServers {
+		sfuConfig.WebRTC.ICEServers = append(sfuConfig.WebRTC.ICEServers, sfu.ICEServerConfig{
+			URLs:       ice.URLs,
+			Username:   ice.Username,
+			Credential: ice.Credential,
+		})
 	}
-	defer close(clientConn.readCh)
-	defer close(clientConn.writeCh)
 
-	roomID := req.PathValue("roomId")
-	if roomID == "" {
-		roomID = h.roomNameGenerator.Generate()
+	wCfg := sfu.NewWebRTCTransportConfig(sfuConfig)
+	base := sfu.NewSession(roomID, h.datachannels, wCfg)
+	session := newObservedSession(base, wCfg.Router)
+
+	stop := make(chan struct{})
+	interval := time.Duration(audioLevelInterval(wCfg.Router)) * time.Millisecond
+	go h.observeSpeakers(roomID, session, interval, stop)
+
+	return &domain.Room{
+		ID:      roomID,
+		Session: session,
+		Config:  wCfg,
+		OnClose: func() {
+			close(stop)
+			// ion-sfu only closes a session when its last peer leaves, which
+			// never happens for a room released before any peer joined.
+			if local, ok := base.(*sfu.SessionLocal); ok {
+				local.Close()
+			}
+		},
 	}
+}
 
-	var room *webRTCRoom
-	var ok bool
-	var session sfu.Session
-	if room, ok = rooms[roomID]; !ok {
-		var conf domain.WebRTCConfig
-		conf, err = h.configFetcher.FetchConfig(1 * time.Hour)
-		if err != nil {
-			slog.Error("Error when fetching config", "err", err)
-			conf = domain.WebRTCConfig{}
-		}
-		var iceServers []sfu.ICEServerConfig
-		for _, ice := range conf.ICEServers {
-			iceServers = append(iceServers, sfu.ICEServerConfig{
-				URLs:       ice.URLs,
-				Username:   ice.Username,
-				Credential: ice.Credential,
-			})
+// broadcast sends a message to every member of the room except the given client.
+func (h *wsHandler) broadcast(roomID string, except WebRTCClientID, msg *WebRTCClientMessage) {
+	for _, m := range h.roomRegistry.Members(roomID) {
+		member := m.(*webRTCClientConn)
+		if member.id == except {
+			continue
 		}
-		sfuConfig := sfu.Config{
-			WebRTC: sfu.WebRTCConfig{
-				ICEServers: iceServers,
-			},
+
+		if err := member.send(msg); err != nil && !errors.Is(err, errConnClosed) {
+			slog.Error("Error broadcasting message", "room", roomID, "client", member.id, "err", err)
 		}
+	}
+}
 
-		wCfg := sfu.NewWebRTCTransportConfig(sfuConfig)
-		session = sfu.NewSession(roomID, nil, wCfg)
-		room = &webRTCRoom{
-			id:      roomID,
-			members: make(map[WebRTCClientID]*webRTCClientConn),
-			session: session,
-			cfg:     &wCfg,
+// roster returns the IDs of all room members except the given client.
+func (h *wsHandler) roster(roomID string, except WebRTCClientID) []WebRTCClientID {
+	peers := make([]WebRTCClientID, 0)
+	for _, m := range h.roomRegistry.Members(roomID) {
+		if id := WebRTCClientID(m.MemberID()); id != except {
+			peers = append(peers, id)
 		}
+	}
+
+	return peers
+}
 
-		roomsMx.Lock()
-		rooms[roomID] = room
-		roomsMx.Unlock()
-		slog.Debug("Created new room", "room", roomID)
+// join assigns a nickname to the client and adds it to the room.
+func (h *wsHandler) join(c *webRTCClientConn, roomID string) error {
+	if err := h.assignNickname(c); err != nil {
+		return err
 	}
 
-	roomsMx.Lock()
-	room.members[clientID] = clientConn
-	roomsMx.Unlock()
-	slog.Debug("Connected to room", "room", roomID, "client", clientID)
+	if err := h.addToRoom(c, roomID); err != nil {
+		h.nicknameGenerator.Release(string(c.id))
+		return err
+	}
 
-	connMx.Lock()
-	webRTCConnections[clientID] = clientConn
-	connMx.Unlock()
+	return nil
+}
 
-	slog.Debug("Client connected", "clientID", clientID)
-	initialMsg := &WebRTCClientMessage{
-		OriginPeerID: clientID,
-		RoomID:       roomID,
+// assignNickname gives the client the display name from its access token
+// if there is one, otherwise a fresh nickname.
+func (h *wsHandler) assignNickname(c *webRTCClientConn) error {
+	if c.displayName == "" {
+		c.id = WebRTCClientID(h.nicknameGenerator.Generate())
+		return nil
 	}
-	payload, _ := json.Marshal(initialMsg)
-	if err := conn.WriteMessage(websocket.TextMessage, payload); err != nil {
-		slog.Error("Error sending initial nickname", "err", err.Error())
+
+	if !h.nicknameGenerator.Reserve(c.displayName) {
+		return domain.ErrNameTaken
 	}
+	c.id = WebRTCClientID(c.displayName)
 
-	peerLocal := sfu.NewPeer(rooms)
-	defer func() {
-		session.RemovePeer(peerLocal)
-		roomsMx.Lock()
-		room := rooms[roomID]
-		delete(room.members, clientID)
+	return nil
+}
 
-		if len(room.members) == 0 {
-			delete(rooms, roomID)
-		}
-		roomsMx.Unlock()
-	}()
-	peerLocal.OnIceCandidate = func(c *webrtc.ICECandidateInit, i int) {
-		msg := WebRTCClientMessage{
+// addToRoom adds a client that already has a nickname to the room. An
+// empty roomID gets a generated room name.
+func (h *wsHandler) addToRoom(c *webRTCClientConn, roomID string) error {
+	if roomID == "" {
+		roomID = h.roomNameGenerator.Generate()
+	}
+
+	if _, err := h.roomRegistry.Acquire(roomID, h.roomFactory(c)); err != nil {
+		h.roomNameGenerator.Release(roomID)
+		return err
+	}
+	c.roomID = roomID
+
+	if err := h.roomRegistry.AddMember(roomID, c); err != nil {
+		h.releaseRoom(roomID)
+		return err
+	}
+
+	return nil
+}
+
+// sendJoinError tells the client why it could not be added to the room.
+func (c *webRTCClientConn) sendJoinError(err error) {
+	switch {
+	case errors.Is(err, domain.ErrRoomFull):
+		c.sendError("", errCodeRoomFull, "room has reached its participant limit", err)
+	case errors.Is(err, domain.ErrServerFull):
+		c.sendError("", errCodeServerFull, "server has reached its participant limit", err)
+	case errors.Is(err, domain.ErrNameTaken):
+		c.sendError("", errCodeNameTaken, "display name is already in use", err)
+	default:
+		c.sendError("", errCodeJoinFailed, "unable to join room", err)
+	}
+}
+
+// enterRoom brings a client that has been added to the room up to date,
+// announces it and joins it to the SFU session.
+func (h *wsHandler) enterRoom(c *webRTCClientConn, hello *WebRTCClientMessage, resumed bool) error {
+	clientID := c.id
+	roomID := c.roomID
+	slog.Debug("Connected to room", "room", roomID, "client", clientID, "resumed", resumed)
+
+	resumeToken, err := h.resumeTokens.Issue(string(clientID), roomID)
+	if err != nil {
+		slog.Error("Error issuing resume token", "client", clientID, "err", err)
+	}
+	h.heldMx.Lock()
+	c.resumeToken = resumeToken
+	h.heldMx.Unlock()
+
+	if err := c.send(h.welcome(c, hello)); err != nil {
+		slog.Error("Error sending welcome", "err", err.Error())
+	}
+
+	h.sendChatHistory(c)
+
+	if err := c.send(&WebRTCClientMessage{
+		RoomID: roomID,
+		SignalingMessage: &WebRTCSignalingMessage{
+			MessageType: presenceRoster,
+			Peers:       h.roster(roomID, clientID),
+		},
+	}); err != nil {
+		slog.Error("Error sending room roster", "err", err.Error())
+	}
+
+	h.sendTracks(roomID, c)
+
+	if !resumed {
+		h.broadcast(roomID, clientID, &WebRTCClientMessage{
 			RoomID:       roomID,
 			OriginPeerID: clientID,
 			SignalingMessage: &WebRTCSignalingMessage{
-				MessageType:   webrtcCandidate,
-				SDPMid:        *c.SDPMid,
-				SDPMLineIndex: c.SDPMLineIndex,
+				MessageType: presencePeerJoined,
 			},
+		})
+	}
+
+	if c.role.CanModerate() {
+		h.sendKnocks(c)
+	}
+
+	if err := h.joinSFU(c); err != nil {
+		c.sendError("", errCodeJoinFailed, "unable to join the SFU session", err)
+		return err
+	}
+	close(c.ready)
+
+	return nil
+}
+
+// resume gives the client the identity and room slot of a held client
+// matching the token. It reports whether the slot could be reclaimed.
+func (h *wsHandler) resume(c *webRTCClientConn, token, roomID string) bool {
+	claims, err := h.resumeTokens.Verify(token)
+	if err != nil {
+		c.sendError("", errCodeResumeFailed, "resume token rejected, joining as a new participant", err)
+		return false
+	}
+
+	if roomID != "" && claims.RoomID != roomID {
+		c.sendError("", errCodeResumeFailed, "resume token is for another room, joining as a new participant",
+			fmt.Errorf("resume token for room %s used for room %s", claims.RoomID, roomID))
+		return false
+	}
+
+	clientID := WebRTCClientID(claims.ClientID)
+
+	old := h.takeOver(clientID, claims.RoomID, token)
+	if old == nil {
+		c.sendError("", errCodeResumeFailed, "session expired, joining as a new participant",
+			fmt.Errorf("no session to resume for client %s", clientID))
+		return false
+	}
+
+	return h.transfer(c, old)
+}
+
+// reclaim gives a client authenticated for the same identity the slot of a
+// held client, so that a reload without a stored resume token does not
+// wait for the grace period to get its display name back.
+func (h *wsHandler) reclaim(c *webRTCClientConn, roomID string) bool {
+	if c.identity == "" || c.displayName == "" {
+		return false
+	}
+
+	clientID := WebRTCClientID(c.displayName)
+	h.heldMx.Lock()
+	held, ok := h.held[clientID]
+	if !ok || held.conn.identity != c.identity || held.conn.roomID != roomID {
+		h.heldMx.Unlock()
+		return false
+	}
+	delete(h.held, clientID)
+	h.heldMx.Unlock()
+	held.timer.Stop()
+
+	return h.transfer(c, held.conn)
+}
+
+// transfer moves the identity and room slot of old to c. It reports
+// whether the client could take the slot.
+func (h *wsHandler) transfer(c, old *webRTCClientConn) bool {
+	c.id = old.id
+	c.roomID = old.roomID
+	old.tracksMx.Lock()
+	c.mutedTracks = old.mutedTracks
+	old.tracksMx.Unlock()
+
+	h.roomRegistry.RemoveMember(c.roomID, string(c.id))
+	if err := h.roomRegistry.AddMember(c.roomID, c); err != nil {
+		c.sendError("", errCodeResumeFailed, "unable to rejoin room, joining as a new participant", err)
+		h.leave(c)
+		return false
+	}
+
+	slog.Debug("Client resumed", "room", c.roomID, "client", c.id)
+	return true
+}
+
+// takeOver claims the slot the resume token was issued for. The slot is
+// either held after a disconnect or, if the server has not noticed the
+// network change yet, still owned by a live connection. A live connection
+// is closed without giving up the slot. It returns nil if there is no slot
+// to take over.
+func (h *wsHandler) takeOver(clientID WebRTCClientID, roomID, token string) *webRTCClientConn {
+	h.heldMx.Lock()
+	if held, ok := h.held[clientID]; ok && held.token == token {
+		delete(h.held, clientID)
+		h.heldMx.Unlock()
+		held.timer.Stop()
+		return held.conn
+	}
+
+	var live *webRTCClientConn
+	if m, ok := h.roomRegistry.Member(roomID, string(clientID)); ok {
+		live = m.(*webRTCClientConn)
+	}
+	if live == nil || live.resumeToken != token || live.evicted.Load() || live.leaving.Load() {
+		h.heldMx.Unlock()
+		return nil
+	}
+	live.replaced.Store(true)
+	h.heldMx.Unlock()
+
+	slog.Debug("Replacing live connection", "room", roomID, "client", clientID)
+	if peerLocal := live.peer(); peerLocal != nil {
+		_ = peerLocal.Close()
+	}
+	live.close()
+
+	return live
+}
+
+// disconnect tears down the media side of the client. Unless the client
+// closed the connection deliberately, was evicted or was replaced by a
+// resumed connection, its nickname and room slot are held for the grace
+// period so that it can resume. A replaced client keeps neither, they have
+// moved to the new connection.
+func (h *wsHandler) disconnect(c *webRTCClientConn) {
+	if c.waiting.Load() {
+		h.leaveLobby(c)
+		return
+	}
+
+	if peerLocal := c.peer(); peerLocal != nil {
+		_ = peerLocal.Close()
+	}
+	h.clearTracks(c.roomID, c)
+	h.stopPublishing(c)
+
+	h.heldMx.Lock()
+	if c.replaced.Load() {
+		h.heldMx.Unlock()
+		return
+	}
+	if h.resumeGrace <= 0 || c.closedByClient.Load() || c.resumeToken == "" || c.evicted.Load() {
+		c.leaving.Store(true)
+		h.heldMx.Unlock()
+		h.leave(c)
+		return
+	}
+	h.held[c.id] = &heldClient{
+		conn:  c,
+		token: c.resumeToken,
+		timer: time.AfterFunc(h.resumeGrace, func() {
+			h.expire(c)
+		}),
+	}
+	h.heldMx.Unlock()
+
+	slog.Debug("Holding client slot", "room", c.roomID, "client", c.id, "grace", h.resumeGrace)
+}
+
+// expire frees the slot of a held client that did not resume in time.
+func (h *wsHandler) expire(c *webRTCClientConn) {
+	h.heldMx.Lock()
+	held, ok := h.held[c.id]
+	if !ok || held.conn != c {
+		h.heldMx.Unlock()
+		return
+	}
+	delete(h.held, c.id)
+	c.leaving.Store(true)
+	h.heldMx.Unlock()
+
+	slog.Debug("Resume grace period expired", "room", c.roomID, "client", c.id)
+	h.leave(c)
+}
+
+// leave removes the client from its room and frees its nickname.
+func (h *wsHandler) leave(c *webRTCClientConn) {
+	h.roomRegistry.RemoveMember(c.roomID, string(c.id))
+	h.broadcast(c.roomID, c.id, &WebRTCClientMessage{
+		RoomID:       c.roomID,
+		OriginPeerID: c.id,
+		SignalingMessage: &WebRTCSignalingMessage{
+			MessageType: presencePeerLeft,
+		},
+	})
+	h.releaseRoom(c.roomID)
+	h.nicknameGenerator.Release(string(c.id))
+}
+
+// releaseRoom drops a room reference and frees the room name and chat
+// history once the room is gone.
+func (h *wsHandler) releaseRoom(roomID string) {
+	if h.roomRegistry.Release(roomID) {
+		h.closeLobby(roomID)
+		h.chatHistory.Clear(roomID)
+		h.roomNameGenerator.Release(roomID)
+	}
+}
+
+// orDefault returns def for messages that do not name a target, as sent by
+// clients that predate targeting.
+func (t WebRTCTransportTarget) orDefault(def WebRTCTransportTarget) WebRTCTransportTarget {
+	if t == "" {
+		return def
+	}
+	return t
+}
+
+func targetFromSFU(i int) WebRTCTransportTarget {
+	if i == 1 {
+		return targetSubscriber
+	}
+	return targetPublisher
+}
+
+// candidateInit converts a candidate message to a pion candidate.
+func (m *WebRTCSignalingMessage) candidateInit() webrtc.ICECandidateInit {
+	c := webrtc.ICECandidateInit{
+		Candidate:     m.Candidate,
+		SDPMLineIndex: m.SDPMLineIndex,
+	}
+	if m.SDPMid != "" {
+		c.SDPMid = &m.SDPMid
+	}
+	if m.UsernameFrag != "" {
+		c.UsernameFragment = &m.UsernameFrag
+	}
+
+	return c
+}
+
+// joinSFU creates a new SFU peer for the client and joins it to the client's room.
+func (h *wsHandler) joinSFU(c *webRTCClientConn) error {
+	peerLocal := sfu.NewPeer(h.roomRegistry)
+	peerLocal.OnIceCandidate = func(ice *webrtc.ICECandidateInit, i int) {
+		signal := &WebRTCSignalingMessage{
+			MessageType:   webrtcCandidate,
+			Candidate:     ice.Candidate,
+			SDPMLineIndex: ice.SDPMLineIndex,
+			Target:        targetFromSFU(i),
 		}
-		_ = conn.WriteJSON(msg)
+		if ice.SDPMid != nil {
+			signal.SDPMid = *ice.SDPMid
+		}
+		if ice.UsernameFragment != nil {
+			signal.UsernameFrag = *ice.UsernameFragment
+		}
+
+		_ = c.send(&WebRTCClientMessage{
+			RoomID:           c.roomID,
+			OriginPeerID:     c.id,
+			SignalingMessage: signal,
+		})
 	}
 
 	peerLocal.OnOffer = func(off *webrtc.SessionDescription) {
-		_ = conn.WriteJSON(WebRTCClientMessage{
-			RoomID: roomID,
+		_ = c.send(&WebRTCClientMessage{
+			ID:     newMessageID(),
+			RoomID: c.roomID,
 			SignalingMessage: &WebRTCSignalingMessage{
 				MessageType: webrtcOffer,
 				SDP:         WebrtcSignalingMessageSDP(off.SDP),
+				Target:      targetSubscriber,
 			},
-			OriginPeerID: clientID,
+			OriginPeerID: c.id,
 		})
 	}
 
-	if err = peerLocal.Join(roomID, string(clientID)); err != nil {
-		slog.Error("Error joining room", "room", roomID, "client", clientID, "err", err.Error())
-		cancel()
+	c.setPeer(peerLocal)
+	if err := peerLocal.Join(c.roomID, string(c.id), sfu.JoinConfig{NoPublish: !c.role.CanPublish()}); err != nil {
+		return err
+	}
+
+	if pub := peerLocal.Publisher(); pub != nil {
+		pub.OnPublisherTrack(func(t sfu.PublisherTrack) {
+			h.addTrack(c.roomID, c, t)
+		})
+		pub.PeerConnection().OnDataChannel(func(dc *webrtc.DataChannel) {
+			rejectClientDatachannel(c, dc)
+		})
+	}
+	h.applyMutes(c)
+
+	return nil
+}
+
+// handleOffer routes a client offer by its target. Offers without a target
+// are publisher offers. The server is always the offerer on the subscriber
+// transport, so a subscriber offer is treated as a renegotiation request and
+// answered with a fresh server offer.
+func (h *wsHandler) handleOffer(c *webRTCClientConn, peerLocal *sfu.PeerLocal, id string, signal *WebRTCSignalingMessage) error {
+	switch target := signal.Target.orDefault(targetPublisher); target {
+	case targetPublisher:
+		if !c.role.CanPublish() {
+			c.sendError(id, errCodeForbidden, "your role does not allow publishing",
+				fmt.Errorf("publisher offer from role %s", c.role))
+			return nil
+		}
+
+		offer := webrtc.SessionDescription{
+			SDP:  string(signal.SDP),
+			Type: webrtc.SDPTypeOffer,
+		}
+		sending, parsed := sentTrackIDs(offer)
+		publishing := parsed && len(sending) > 0
+		reserved := publishing && !c.publishing.Load()
+		if reserved {
+			if err := h.roomRegistry.AddPublisher(c.roomID, c); err != nil {
+				if errors.Is(err, domain.ErrPublisherLimit) {
+					c.sendError(id, errCodePublisherLimit, "room has reached its publisher limit", nil)
+					return nil
+				}
+				return err
+			}
+		}
+
+		answer, err := peerLocal.Answer(offer)
+		if err != nil {
+			if reserved {
+				h.roomRegistry.RemovePublisher(c.roomID, c)
+			}
+			return err
+		}
+		if parsed {
+			if publishing {
+				c.publishing.Store(true)
+			} else {
+				h.stopPublishing(c)
+			}
+			h.syncTracks(c.roomID, c, sending)
+		}
+
+		return c.send(&WebRTCClientMessage{
+			ID:     id,
+			RoomID: c.roomID,
+			SignalingMessage: &WebRTCSignalingMessage{
+				MessageType: webrtcAnswer,
+				SDP:         WebrtcSignalingMessageSDP(answer.SDP),
+				Target:      targetPublisher,
+			},
+			OriginPeerID: c.id,
+		})
+	case targetSubscriber:
+		sub := peerLocal.Subscriber()
+		if sub == nil {
+			return sfu.ErrNoTransportEstablished
+		}
+		sub.Negotiate()
+		return nil
+	default:
+		return fmt.Errorf("unknown offer target %q", target)
+	}
+}
+
+// handleAnswer routes a client answer by its target. Answers without a
+// target belong to the subscriber transport, where the server offers.
+func (h *wsHandler) handleAnswer(peerLocal *sfu.PeerLocal, signal *WebRTCSignalingMessage) error {
+	answer := webrtc.SessionDescription{
+		Type: webrtc.SDPTypeAnswer,
+		SDP:  string(signal.SDP),
+	}
+
+	switch target := signal.Target.orDefault(targetSubscriber); target {
+	case targetSubscriber:
+		return peerLocal.SetRemoteDescription(answer)
+	case targetPublisher:
+		pub := peerLocal.Publisher()
+		if pub == nil {
+			return sfu.ErrNoTransportEstablished
+		}
+		if pub.SignalingState() != webrtc.SignalingStateHaveLocalOffer {
+			return fmt.Errorf("no pending publisher offer")
+		}
+		return pub.PeerConnection().SetRemoteDescription(answer)
+	default:
+		return fmt.Errorf("unknown answer target %q", target)
+	}
+}
+
+// handleCandidate adds a client candidate to the transport it targets.
+// Candidates without a target belong to the publisher transport. The
+// transports are used directly since ion-sfu's Trickle fails for peers
+// without a publisher transport, which subscribers join without.
+func (h *wsHandler) handleCandidate(c *webRTCClientConn, peerLocal *sfu.PeerLocal, id string, signal *WebRTCSignalingMessage) {
+	candidate := signal.candidateInit()
+
+	var err error
+	switch target := signal.Target.orDefault(targetPublisher); target {
+	case targetPublisher:
+		pub := peerLocal.Publisher()
+		if pub == nil {
+			c.sendError(id, errCodeForbidden, "your role does not allow publishing",
+				fmt.Errorf("publisher candidate from role %s", c.role))
+			return
+		}
+		err = pub.AddICECandidate(candidate)
+	case targetSubscriber:
+		sub := peerLocal.Subscriber()
+		if sub == nil {
+			err = sfu.ErrNoTransportEstablished
+			break
+		}
+		err = sub.AddICECandidate(candidate)
+	default:
+		c.sendError(id, errCodeCandidateFailed, "unknown candidate target",
+			fmt.Errorf("unknown candidate target %q", target))
+		return
+	}
+
+	if err != nil {
+		c.sendError(id, errCodeCandidateFailed, "unable to add candidate", err)
+	}
+}
+
+// stopPublishing frees the publisher slot of the client.
+func (h *wsHandler) stopPublishing(c *webRTCClientConn) {
+	c.publishing.Store(false)
+	h.roomRegistry.RemovePublisher(c.roomID, c)
+}
+
+// restartICE replaces the SFU peer of the client with a fresh one, which
+// restarts ICE on both the publisher and the subscriber transport.
+// ion-sfu does not expose an ICE restart on an existing subscriber
+// transport, so both transports are rebuilt. The client is told to
+// re-publish and receives a fresh subscriber offer afterwards. Candidates
+// are ignored until the client sends its next description.
+func (h *wsHandler) restartICE(c *webRTCClientConn, id string) error {
+	c.restarting.Store(true)
+	h.stopPublishing(c)
+
+	if old := c.peer(); old != nil {
+		_ = old.Close()
+	}
+	h.clearTracks(c.roomID, c)
+
+	if err := c.send(&WebRTCClientMessage{
+		ID:           id,
+		RoomID:       c.roomID,
+		OriginPeerID: c.id,
+		SignalingMessage: &WebRTCSignalingMessage{
+			MessageType: webrtcICERestart,
+		},
+	}); err != nil {
+		return err
+	}
+
+	return h.joinSFU(c)
+}
+
+func (h *wsHandler) HandleWS(rw http.ResponseWriter, req *http.Request) {
+	ctx, cancel := context.WithCancel(req.Context())
+	defer cancel()
+
+	claims, ok := h.authenticate(rw, req)
+	if !ok {
+		return
+	}
+
+	conn, err := h.upgrader.Upgrade(rw, req, nil)
+	if err != nil {
+		slog.Error("Error when upgrading to websocket", "err", err.Error())
+		return
+	}
+	defer conn.Close()
+
+	_ = conn.SetReadDeadline(time.Now().Add(h.helloTimeout))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(h.pongTimeout))
+	})
+
+	clientConn := &webRTCClientConn{
+		conn:         conn,
+		writeTimeout: h.writeTimeout,
+		dropSlow:     h.dropSlowClients,
+		role:         claims.Role,
+		identity:     claims.Subject,
+		displayName:  claims.Name,
+		tracks:       make(map[string]*WebRTCTrackMeta),
+		mutedTracks:  make(map[string]struct{}),
+		writeCh:      make(chan *WebRTCClientMessage, h.writeQueueSize),
+		done:         make(chan struct{}),
+		writerDone:   make(chan struct{}),
+		admitted:     make(chan struct{}),
+		ready:        make(chan struct{}),
+	}
+
+	go clientConn.writePump(h.pingInterval)
+	defer func() {
+		clientConn.close()
+		<-clientConn.writerDone
+	}()
+
+	hello, err := h.handshake(clientConn)
+	if err != nil {
+		slog.Warn("Handshake failed", "err", err)
+		return
+	}
+
+	roomID := req.PathValue("roomId")
+	resumed := false
+	if token := req.URL.Query().Get(resumeTokenParam); token != "" {
+		resumed = h.resume(clientConn, token, roomID)
+	}
+	if !resumed {
+		resumed = h.reclaim(clientConn, roomID)
+	}
+	if !resumed {
+		waiting, err := h.knock(clientConn, roomID, hello)
+		if err == nil && !waiting {
+			err = h.join(clientConn, roomID)
+		}
+		if err != nil {
+			clientConn.sendJoinError(err)
+			return
+		}
+	}
+	// The reader may still be rebuilding the SFU peer during an ICE restart,
+	// so it has to stop before the client is torn down.
+	readerDone := make(chan struct{})
+	defer func() {
+		clientConn.close()
+		<-clientConn.writerDone
+		_ = conn.Close()
+		<-readerDone
+		h.disconnect(clientConn)
+	}()
+
+	clientID := clientConn.id
+	if !clientConn.waiting.Load() {
+		if err := h.enterRoom(clientConn, hello, resumed); err != nil {
+			cancel()
+		}
 	}
 
 	go func(ctx context.Context) {
+		defer close(readerDone)
+		defer cancel()
+
 		for {
-			var m WebRTCClientMessage
-			err = clientConn.conn.ReadJSON(&m)
+			_, payload, err := clientConn.conn.ReadMessage()
 			if err != nil {
 				slog.Error("Error when reading websocket message", "err", err.Error())
-				if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-					break
+				if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+					clientConn.closedByClient.Store(true)
 				}
 				break
 			}
 
+			var m WebRTCClientMessage
+			if err := json.Unmarshal(payload, &m); err != nil {
+				clientConn.sendError("", errCodeInvalidMessage, "message is not valid JSON", err)
+				continue
+			}
+
 			if m.SignalingMessage == nil {
+				clientConn.sendError(m.ID, errCodeInvalidMessage, "message has no signal",
+					fmt.Errorf("message without signal"))
 				continue
 			}
 
+			if clientConn.waiting.Load() {
+				clientConn.sendError(m.ID, errCodeInLobby, "waiting for a moderator to admit you",
+					fmt.Errorf("%s message while in lobby", m.SignalingMessage.MessageType))
+				continue
+			}
+			select {
+			case <-clientConn.ready:
+			case <-clientConn.done:
+				return
+			}
+
+			if m.ReceiverPeerID != "" && m.ReceiverPeerID != clientID {
+				h.forward(clientConn, &m)
+				continue
+			}
+
+			peerLocal := clientConn.peer()
+
 			switch m.SignalingMessage.MessageType {
 			case webrtcOffer:
-				slog.Debug("Received offer", "from", m.OriginPeerID)
-				offer := webrtc.SessionDescription{
-					SDP:  string(m.SignalingMessage.SDP),
-					Type: webrtc.SDPTypeOffer,
+				clientConn.restarting.Store(false)
+				slog.Debug("Received offer", "from", m.OriginPeerID, "target", m.SignalingMessage.Target)
+				if err := h.handleOffer(clientConn, peerLocal, m.ID, m.SignalingMessage); err != nil {
+					clientConn.sendError(m.ID, errCodeOfferFailed, "unable to answer offer", err)
 				}
-				answer, err := peerLocal.Answer(offer)
-				if err != nil {
-					slog.Error("Unable to set remote description", "err", err)
-					return
-				}
-				_ = conn.WriteJSON(WebRTCClientMessage{
-					RoomID: roomID,
-					SignalingMessage: &WebRTCSignalingMessage{
-						MessageType: webrtcAnswer,
-						SDP:         WebrtcSignalingMessageSDP(answer.SDP),
-					},
-					OriginPeerID: clientID,
-				})
 
 			case webrtcCandidate:
-				_ = peerLocal.Trickle(webrtc.ICECandidateInit{
-					Candidate:     m.SignalingMessage.Candidate,
-					SDPMid:        &m.SignalingMessage.SDPMid,
-					SDPMLineIndex: m.SignalingMessage.SDPMLineIndex,
-				}, 0)
+				if clientConn.restarting.Load() {
+					slog.Debug("Ignoring candidate during ICE restart", "client", clientID)
+					continue
+				}
+				h.handleCandidate(clientConn, peerLocal, m.ID, m.SignalingMessage)
 			case webrtcAnswer:
-				_ = peerLocal.SetRemoteDescription(webrtc.SessionDescription{
-					Type: webrtc.SDPTypeAnswer,
-					SDP:  string(m.SignalingMessage.SDP),
-				})
+				clientConn.restarting.Store(false)
+				if err := h.handleAnswer(peerLocal, m.SignalingMessage); err != nil {
+					clientConn.sendError(m.ID, errCodeAnswerFailed, "unable to apply answer", err)
+				}
+			case webrtcLayer:
+				if err := switchLayer(peerLocal, m.SignalingMessage.Layer); err != nil {
+					clientConn.sendError(m.ID, errCodeLayerFailed, "unable to switch layer", err)
+				}
+			case webrtcChat:
+				h.handleChat(clientConn, m.ID, m.SignalingMessage)
+			case webrtcControl:
+				h.handleControl(clientConn, m.ID, m.SignalingMessage.Control)
+			case webrtcICERestart:
+				slog.Debug("Received ICE restart request", "from", clientID)
+				if err := h.restartICE(clientConn, m.ID); err != nil {
+					clientConn.sendError(m.ID, errCodeICERestartFailed, "unable to restart ICE", err)
+					return
+				}
 			default:
-				slog.Warn("Unsupported signaling message", "type", m.SignalingMessage.MessageType)
-				continue
+				clientConn.sendError(m.ID, errCodeUnsupportedType, "unsupported message type",
+					fmt.Errorf("unsupported message type %q", m.SignalingMessage.MessageType))
 			}
 		}
-
-		cancel()
 	}(ctx)
 
-	<-ctx.Done()
+	if clientConn.waiting.Load() {
+		select {
+		case <-clientConn.admitted:
+		case <-ctx.Done():
+			return
+		case <-clientConn.done:
+			return
+		}
+
+		if err := h.addToRoom(clientConn, roomID); err != nil {
+			clientConn.sendJoinError(err)
+			return
+		}
+		clientConn.waiting.Store(false)
+
+		if err := h.enterRoom(clientConn, hello, false); err != nil {
+			return
+		}
+	}
+
+	select {
+	case <-ctx.Done():
+	case <-clientConn.done:
+	}
 }
@@ -0,0 +1,300 @@
+package handler
+
+import (
+	"encoding/json"
+	"github.com/caarlos0/env/v11"
+	"github.com/gorilla/websocket"
+	"github.com/ownerofglory/webrtc-sfu-demo/config"
+	"github.com/ownerofglory/webrtc-sfu-demo/internal/core/domain"
+	"github.com/ownerofglory/webrtc-sfu-demo/internal/core/ports"
+	"github.com/ownerofglory/webrtc-sfu-demo/internal/core/services"
+	"github.com/pion/ion-sfu/pkg/buffer"
+	"github.com/pion/ion-sfu/pkg/sfu"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testAuthSecret = "test-secret"
+
+type staticConfigFetcher struct{}
+
+func (staticConfigFetcher) FetchConfig(time.Duration) (domain.WebRTCConfig, error) {
+	return domain.WebRTCConfig{}, nil
+}
+
+// newTestServer serves a websocket handler with the default config. With
+// auth set, clients need an access token issued by issueToken.
+func newTestServer(t *testing.T, auth bool) (*httptest.Server, *wsHandler) {
+	t.Helper()
+
+	var cfg config.WebRTCSFUAppConfig
+	if err := env.ParseWithOptions(&cfg, env.Options{Environment: map[string]string{}}); err != nil {
+		t.Fatalf("parse config: %v", err)
+	}
+	sfuConfig, err := cfg.SFUConfig()
+	if err != nil {
+		t.Fatalf("sfu config: %v", err)
+	}
+	sfuConfig.BufferFactory = buffer.NewBufferFactory(sfuConfig.Router.MaxPacketTrack, sfu.Logger)
+
+	var verifier ports.TokenVerifier
+	if auth {
+		verifier = services.NewAccessTokenService([]byte(testAuthSecret))
+	}
+
+	h := NewWSHandler(&cfg,
+		sfuConfig,
+		sfu.NewSFU(sfuConfig),
+		staticConfigFetcher{},
+		services.NewNicknameGenerator(),
+		services.NewRoomGenerator(),
+		services.NewRoomRegistry(cfg.RoomMaxParticipants, cfg.RoomMaxPublishers, cfg.MaxPeers),
+		services.NewResumeTokenService([]byte("resume-secret")),
+		services.NewChatHistory(cfg.ChatHistorySize),
+		verifier)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(WSPath, h.HandleWS)
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	return srv, h
+}
+
+// waitHeld waits until the server holds the slot of a disconnected client.
+func waitHeld(t *testing.T, h *wsHandler, id WebRTCClientID) {
+	t.Helper()
+
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		h.heldMx.Lock()
+		_, held := h.held[id]
+		h.heldMx.Unlock()
+		if held {
+			return
+		}
+	}
+	t.Fatalf("slot of %s not held", id)
+}
+
+func issueToken(t *testing.T, room, identity string, role domain.Role) string {
+	t.Helper()
+
+	token, _, err := services.NewAccessTokenService([]byte(testAuthSecret)).Issue(domain.AccessClaims{
+		Subject: identity,
+		Room:    room,
+		Name:    identity,
+		Role:    role,
+	}, time.Minute)
+	if err != nil {
+		t.Fatalf("issue token: %v", err)
+	}
+
+	return token
+}
+
+type testClient struct {
+	t    *testing.T
+	conn *websocket.Conn
+	id   WebRTCClientID
+	// resumeToken is the token of the welcome.
+	resumeToken string
+}
+
+// dial connects to a room without sending a hello.
+func dial(t *testing.T, srv *httptest.Server, room string, query url.Values) *testClient {
+	t.Helper()
+
+	u := "ws" + strings.TrimPrefix(srv.URL, "http") + basePathWS + "/" + room
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	header := http.Header{"Origin": []string{"*"}}
+	conn, _, err := (&websocket.Dialer{Subprotocols: []string{wsSubprotocol}}).Dial(u, header)
+	if err != nil {
+		t.Fatalf("dial %s: %v", u, err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	return &testClient{t: t, conn: conn}
+}
+
+// join connects to a room and waits for the welcome.
+func join(t *testing.T, srv *httptest.Server, room string, query url.Values) *testClient {
+	t.Helper()
+
+	c := dial(t, srv, room, query)
+	c.hello()
+	welcome := c.expect(webrtcWelcome)
+	c.id = welcome.OriginPeerID
+	c.resumeToken = welcome.ResumeToken
+
+	return c
+}
+
+func (c *testClient) hello() {
+	c.send(&WebRTCClientMessage{
+		ID: "hello",
+		SignalingMessage: &WebRTCSignalingMessage{
+			MessageType: webrtcHello,
+			Handshake:   &WebRTCHandshake{Version: protocolVersion},
+		},
+	})
+}
+
+func (c *testClient) send(msg *WebRTCClientMessage) {
+	c.t.Helper()
+
+	if err := c.conn.WriteJSON(msg); err != nil {
+		c.t.Fatalf("write: %v", err)
+	}
+}
+
+// next returns the next message, skipping media negotiation and speaker
+// updates that arrive at their own pace.
+func (c *testClient) next() *WebRTCClientMessage {
+	c.t.Helper()
+
+	_ = c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		_, payload, err := c.conn.ReadMessage()
+		if err != nil {
+			c.t.Fatalf("read: %v", err)
+		}
+
+		var m WebRTCClientMessage
+		if err := json.Unmarshal(payload, &m); err != nil {
+			c.t.Fatalf("unmarshal %s: %v", payload, err)
+		}
+		switch m.SignalingMessage.MessageType {
+		case webrtcOffer, webrtcCandidate, activeSpeaker:
+			continue
+		}
+
+		return &m
+	}
+}
+
+// expect skips messages until one of type t arrives.
+func (c *testClient) expect(t WebRTCSignalingMessageType) *WebRTCClientMessage {
+	c.t.Helper()
+
+	for {
+		if m := c.next(); m.SignalingMessage.MessageType == t {
+			return m
+		}
+	}
+}
+
+// expectNext fails unless the next message is of type t.
+func (c *testClient) expectNext(t WebRTCSignalingMessageType) *WebRTCClientMessage {
+	c.t.Helper()
+
+	m := c.next()
+	if m.SignalingMessage.MessageType != t {
+		c.t.Fatalf("got %s message from %s, want %s", m.SignalingMessage.MessageType, m.OriginPeerID, t)
+	}
+
+	return m
+}
+
+// expectError skips messages until an error arrives and checks its code.
+func (c *testClient) expectError(id string, code WebRTCErrorCode) {
+	c.t.Helper()
+
+	m := c.expect(webrtcError)
+	if m.ID != id || m.SignalingMessage.Error.Code != code {
+		c.t.Fatalf("got error %s for %q, want %s for %q", m.SignalingMessage.Error.Code, m.ID, code, id)
+	}
+}
+
+// expectClosed waits until the server closes the connection.
+func (c *testClient) expectClosed() {
+	c.t.Helper()
+
+	_ = c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		if _, _, err := c.conn.ReadMessage(); err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure) {
+				c.t.Fatalf("connection not closed by the server: %v", err)
+			}
+			return
+		}
+	}
+}
+
+// chat sends a chat message to the room.
+func (c *testClient) chat(id, text string) {
+	c.send(&WebRTCClientMessage{
+		ID:               id,
+		SignalingMessage: &WebRTCSignalingMessage{MessageType: webrtcChat, Text: text},
+	})
+}
+
+// drop cuts the connection without a close frame, like a network failure.
+func (c *testClient) drop() {
+	_ = c.conn.UnderlyingConn().Close()
+}
+
+func TestResumeTakesOverSlot(t *testing.T) {
+	tests := []struct {
+		name       string
+		disconnect func(h *wsHandler, old *testClient)
+	}{
+		{
+			name: "held after a network failure",
+			disconnect: func(h *wsHandler, old *testClient) {
+				old.drop()
+				waitHeld(t, h, old.id)
+			},
+		},
+		{
+			name:       "old connection still live",
+			disconnect: func(*wsHandler, *testClient) {},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, h := newTestServer(t, false)
+			observer := join(t, srv, "room", nil)
+			old := join(t, srv, "room", nil)
+			observer.expect(presencePeerJoined)
+
+			tt.disconnect(h, old)
+			resumed := join(t, srv, "room", url.Values{resumeTokenParam: {old.resumeToken}})
+			if resumed.id != old.id {
+				t.Fatalf("resumed as %s, want %s", resumed.id, old.id)
+			}
+
+			// The slot moved without the room seeing the client leave.
+			resumed.chat("after", "back")
+			if m := observer.expectNext(webrtcChat); m.OriginPeerID != old.id {
+				t.Errorf("chat from %s, want %s", m.OriginPeerID, old.id)
+			}
+		})
+	}
+}
+
+func TestSameIdentityReclaimsHeldSlot(t *testing.T) {
+	srv, h := newTestServer(t, true)
+	observer := join(t, srv, "room", url.Values{accessTokenParam: {issueToken(t, "room", "observer", domain.RolePublisher)}})
+	token := issueToken(t, "room", "alice", domain.RolePublisher)
+	old := join(t, srv, "room", url.Values{accessTokenParam: {token}})
+	observer.expect(presencePeerJoined)
+
+	old.drop()
+	waitHeld(t, h, old.id)
+	// Without a resume token the display name would be taken until the
+	// held slot expires.
+	reloaded := join(t, srv, "room", url.Values{accessTokenParam: {token}})
+	if reloaded.id != "alice" {
+		t.Fatalf("joined as %s, want alice", reloaded.id)
+	}
+
+	reloaded.chat("after", "back")
+	observer.expectNext(webrtcChat)
+}